@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"gt/services"
+	"gt/services/container"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const publicationDateLayout = "2006-01-02"
+
+// app holds global flags shared by every command.
+type app struct {
+	configPath string
+	verbose    bool
+}
+
+func newRootCommand() *cobra.Command {
+	a := &app{}
+
+	root := &cobra.Command{
+		Use:   "gt",
+		Short: "Create, sign, verify and extend KSI signed containers",
+		Long: `gt manages zip containers of data files signed with Guardtime KSI signatures.
+
+Every signature signs a manifest which lists data files it covers. Settings (KSI
+credentials, endpoints, hash algorithms, container format) are applied in order:
+built-in defaults, $XDG_CONFIG_HOME/gt/config, ./settings.json and GT_* environment
+variables, later ones override earlier ones. --config replaces both settings files.
+Command flags override settings.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		// Without command only usage is printed, which is an error as in any other invalid call.
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return usageErrorf("missing command")
+		},
+	}
+	root.PersistentFlags().StringVar(&a.configPath, "config", "", "path to settings file, replaces $XDG_CONFIG_HOME/gt/config and ./settings.json")
+	root.PersistentFlags().BoolVarP(&a.verbose, "verbose", "v", false, "print progress to standard error")
+	root.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+
+	root.AddCommand(
+		a.newCreateCommand(),
+		a.newOpenCommand(),
+		a.newAddSignatureCommand(),
+		a.newSignBatchCommand(),
+		a.newRemoveSignatureCommand(),
+		a.newMigrateCommand(),
+		a.newVerifyCommand(),
+		a.newExtendCommand(),
+		a.newInfoCommand(),
+		a.newConfigCommand(),
+	)
+	return root
+}
+
+func (a *app) newCreateCommand() *cobra.Command {
+	var (
+		out    string
+		files  []string
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create --out <container> <file>...",
+		Short: "Create new container and sign given files",
+		Long: `Create new container from data files and sign them.
+
+Directories are added recursively. Relative paths keep their directory structure
+inside container, absolute paths and paths outside of working directory are stored
+under their base name. Files can be given as arguments, with --files or both.`,
+		Example: `  gt create --out container.zip report.pdf data/
+  gt create --out container.asice --format asice --files a.txt,b.txt`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args)+len(files) == 0 {
+				return usageErrorf("no files given, pass files as arguments or with --files")
+			}
+			return nil
+		},
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			if !cmd.Flags().Changed("format") {
+				format = settings.ContainerFormat
+			}
+			f, err := container.ParseFormat(format)
+			if err != nil {
+				return &usageError{err: err}
+			}
+
+			dataFileAlg, manifestAlg, err := hashAlgorithms(settings)
+			if err != nil {
+				return err
+			}
+			ksiSigner, err := newKSISigner(settings)
+			if err != nil {
+				return err
+			}
+			defer a.logAggregatorHealth(cmd, ksiSigner)
+			signatureCreator := newSignatureCreator(settings, ksiSigner)
+
+			creator := container.NewCreator(signatureCreator, newArchiveService(settings),
+				container.CreatorOptFormat(f),
+				container.CreatorOptHashAlgorithms(dataFileAlg, manifestAlg),
+			)
+			paths := append(append([]string(nil), args...), files...)
+			if err := creator.CreateContext(cmd.Context(), paths, out); err != nil {
+				return err
+			}
+
+			a.logf(cmd, "created %s container %s", f, out)
+			return nil
+		}),
+	}
+	cmd.Flags().StringVarP(&out, "out", "o", "", "path of created container")
+	cmd.Flags().StringSliceVar(&files, "files", nil, "comma separated list of files and directories to add")
+	cmd.Flags().StringVar(&format, "format", "", "container format: json or asice (default from settings)")
+	_ = cmd.MarkFlagRequired("out")
+	_ = cmd.RegisterFlagCompletionFunc("format", fixedCompletions(string(container.FormatJSON), string(container.FormatASiCE)))
+	return cmd
+}
+
+func (a *app) newOpenCommand() *cobra.Command {
+	var out string
+
+	cmd := &cobra.Command{
+		Use:   "open <container> --out <dir>",
+		Short: "Extract container into directory",
+		Long: `Extract container into directory and print its content.
+
+Output directory must not exist or be empty. Nothing is written there when
+extraction fails.`,
+		Args: exactArgs("container"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			archiveService := newArchiveService(settings)
+			paths, err := archiveService.Extract(args[0], out)
+			if err != nil {
+				return err
+			}
+			format, err := container.NewInspector(services.NewKSIInspector(), archiveService).Format(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "container format:", format)
+			fmt.Fprintln(cmd.OutOrStdout(), "extacted container files: ", paths)
+			return nil
+		}),
+	}
+	cmd.Flags().StringVarP(&out, "out", "o", "", "directory to extract container into")
+	_ = cmd.MarkFlagRequired("out")
+	_ = cmd.MarkFlagDirname("out")
+	return cmd
+}
+
+func (a *app) newAddSignatureCommand() *cobra.Command {
+	var files []string
+
+	cmd := &cobra.Command{
+		Use:   "add-signature <container>",
+		Short: "Add new signature to container",
+		Long: `Add new signature to existing container.
+
+By default new signature covers every data file in container. Files can be given
+with --files by container path or glob pattern, every pattern must match at least
+one data file.`,
+		Example: `  gt add-signature container.zip
+  gt add-signature container.zip --files 'docs/*.pdf,summary.txt'`,
+		Args: exactArgs("container"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			dataFileAlg, manifestAlg, err := hashAlgorithms(settings)
+			if err != nil {
+				return err
+			}
+			ksiSigner, err := newKSISigner(settings)
+			if err != nil {
+				return err
+			}
+			defer a.logAggregatorHealth(cmd, ksiSigner)
+			signatureCreator := newSignatureCreator(settings, ksiSigner)
+
+			signer := container.NewSigner(signatureCreator, newArchiveService(settings),
+				container.SignerOptHashAlgorithms(dataFileAlg, manifestAlg),
+				container.SignerOptBackup(settings.Backup),
+			)
+			if err := signer.AddSignatureContext(cmd.Context(), args[0], files...); err != nil {
+				return err
+			}
+
+			a.logf(cmd, "signature added to %s", args[0])
+			return nil
+		}),
+	}
+	cmd.Flags().StringSliceVar(&files, "files", nil, "comma separated list of container paths or glob patterns to sign")
+	return cmd
+}
+
+func (a *app) newSignBatchCommand() *cobra.Command {
+	var files []string
+
+	cmd := &cobra.Command{
+		Use:   "sign-batch <dir|list>",
+		Short: "Add new signature to many containers with single KSI request",
+		Long: `Add new signature to every container in directory or in list file.
+
+Directory is not searched recursively, files with .zip, .asice or .sce extension
+are signed. List file has one container path per line, empty lines and lines
+starting with # are skipped, - reads list from standard input.
+
+Manifests of all containers are aggregated into local hash tree and only its root
+is sent to KSI service, signature of every container is derived from signature
+of the root. Containers which can not be read are reported and the rest are
+signed anyway. --files selects data files like in add-signature.`,
+		Example: `  gt sign-batch containers/
+  find . -name '*.zip' | gt sign-batch -`,
+		Args: exactArgs("dir|list"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			paths, err := batchContainers(args[0], cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			dataFileAlg, manifestAlg, err := hashAlgorithms(settings)
+			if err != nil {
+				return err
+			}
+			ksiSigner, err := newKSISigner(settings)
+			if err != nil {
+				return err
+			}
+			defer a.logAggregatorHealth(cmd, ksiSigner)
+			signatureCreator := newSignatureCreator(settings, ksiSigner)
+
+			signer := container.NewSigner(signatureCreator, newArchiveService(settings),
+				container.SignerOptHashAlgorithms(dataFileAlg, manifestAlg),
+				container.SignerOptBackup(settings.Backup),
+			)
+			a.logf(cmd, "signing %d containers", len(paths))
+			results, err := signer.AddSignatureBatch(cmd.Context(), paths, files...)
+
+			var (
+				failed   int
+				firstErr error
+			)
+			for _, r := range results {
+				switch {
+				case r.Err != nil:
+					failed++
+					if firstErr == nil {
+						firstErr = r.Err
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: not signed: %v\n", r.ContainerPath, r.Err)
+				case r.SignatureID != 0:
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: signature %d added\n", r.ContainerPath, r.SignatureID)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d containers were not signed, first error: %w", failed, len(results), firstErr)
+			}
+			return nil
+		}),
+	}
+	cmd.Flags().StringSliceVar(&files, "files", nil, "comma separated list of container paths or glob patterns to sign in every container")
+	return cmd
+}
+
+func (a *app) newRemoveSignatureCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove-signature <container> <id>",
+		Short: "Remove signature from container by id",
+		Long: `Remove signature and its manifest from container.
+
+Signature id is the number in manifest name, as printed by info and verify.
+Warning is printed for every manifest which refers to removed manifest in its
+previous manifests, verify reports such references as missing.`,
+		Args: exactArgs("container", "id"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.Atoi(args[1])
+			if err != nil {
+				return usageErrorf("invalid signature id '%s'", args[1])
+			}
+
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			// Only manifests are read to find references to removed manifest, data files are not hashed.
+			archiveService := newArchiveService(settings)
+			sigs, err := container.NewInspector(services.NewKSIInspector(), archiveService).Manifests(args[0])
+			if err != nil {
+				return err
+			}
+
+			// Removing signature needs no KSI service.
+			signer := container.NewSigner(nil, archiveService,
+				container.SignerOptBackup(settings.Backup),
+			)
+			if err := signer.RemoveSignature(args[0], id); err != nil {
+				return err
+			}
+			printDanglingReferences(cmd.ErrOrStderr(), sigs, id)
+
+			a.logf(cmd, "signature %v removed from %s", id, args[0])
+			return nil
+		}),
+	}
+	return cmd
+}
+
+func (a *app) newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate <container>",
+		Short: "Give stable ids to signatures of older containers",
+		Long: `Rename manifests without valid id in their name after new stable ids.
+
+Signatures are left untouched. Duplicate manifests and signatures left by older
+versions get new ids together. Containers which already have stable ids are not
+changed, containers whose renamed manifests are referenced by other manifests
+are not migrated.`,
+		Args: exactArgs("container"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			// Migration only renames entries, it needs no KSI service.
+			signer := container.NewSigner(nil, newArchiveService(settings),
+				container.SignerOptBackup(settings.Backup),
+			)
+			migrations, err := signer.Migrate(args[0])
+			if err != nil {
+				return err
+			}
+
+			if len(migrations) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "every signature has stable id, nothing to migrate")
+			}
+			for _, m := range migrations {
+				fmt.Fprintf(cmd.OutOrStdout(), "manifest %s renamed to %s, signature id %v\n", m.OldManifestUri, m.ManifestUri, m.ID)
+				if m.SignatureUri != "" {
+					fmt.Fprintf(cmd.OutOrStdout(), "signature %s renamed to %s\n", m.OldSignatureUri, m.SignatureUri)
+				}
+			}
+			return nil
+		}),
+	}
+	return cmd
+}
+
+func (a *app) newVerifyCommand() *cobra.Command {
+	var (
+		policy  string
+		jsonOut bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify <container>",
+		Short: "Verify every manifest and signature in container",
+		Long: `Verify every manifest and signature in container and print report.
+
+Exits with code 1 when container is invalid. Verification policy defaults to
+verification_policy from settings file.`,
+		Args: exactArgs("container"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			if !cmd.Flags().Changed("policy") {
+				policy = settings.VerificationPolicy
+			}
+			p, err := services.ParseVerificationPolicy(policy)
+			if err != nil {
+				return &usageError{err: err}
+			}
+
+			ksiVerifier, err := newKSIVerifier(settings)
+			if err != nil {
+				return err
+			}
+
+			a.logf(cmd, "verifying %s with %s policy", args[0], p)
+			report, err := container.NewVerifier(ksiVerifier, newArchiveService(settings)).Verify(args[0], p)
+			if err != nil {
+				return err
+			}
+
+			if jsonOut {
+				if err := printVerificationReportJSON(cmd.OutOrStdout(), report); err != nil {
+					return err
+				}
+			} else {
+				printVerificationReport(cmd.OutOrStdout(), report)
+			}
+			if !report.Valid() {
+				return errInvalidContainer
+			}
+			return nil
+		}),
+	}
+	cmd.Flags().StringVar(&policy, "policy", "", "verification policy: internal, key, calendar, publication or default (default from settings)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print report as JSON")
+	_ = cmd.RegisterFlagCompletionFunc("policy", fixedCompletions(
+		string(services.PolicyInternal),
+		string(services.PolicyKeyBased),
+		string(services.PolicyCalendarBased),
+		string(services.PolicyPublicationBased),
+		string(services.PolicyDefault),
+	))
+	return cmd
+}
+
+func (a *app) newExtendCommand() *cobra.Command {
+	var publicationDate string
+
+	cmd := &cobra.Command{
+		Use:   "extend <container>",
+		Short: "Extend every signature in container to publication",
+		Long: `Extend every signature in container using extender from settings file.
+
+Without --publication-date signatures are extended to the nearest publication
+found in publications file.`,
+		Args: exactArgs("container"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			var pubTime time.Time
+			if publicationDate != "" {
+				t, err := time.Parse(publicationDateLayout, publicationDate)
+				if err != nil {
+					return usageErrorf("invalid publication date '%s', expected YYYY-MM-DD", publicationDate)
+				}
+				pubTime = t
+			}
+
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+			ksiExtender, err := newKSIExtender(settings)
+			if err != nil {
+				return err
+			}
+
+			extender := container.NewExtender(ksiExtender, newArchiveService(settings),
+				container.ExtenderOptBackup(settings.Backup),
+			)
+			if err := extender.ExtendContext(cmd.Context(), args[0], pubTime); err != nil {
+				return err
+			}
+
+			a.logf(cmd, "signatures of %s extended", args[0])
+			return nil
+		}),
+	}
+	cmd.Flags().StringVar(&publicationDate, "publication-date", "", "publication date in format YYYY-MM-DD")
+	return cmd
+}
+
+func (a *app) newInfoCommand() *cobra.Command {
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "info <container>",
+		Short: "Print container content and signature metadata",
+		Long: `Print every data file, manifest and signature metadata without extracting container.
+
+Nothing is verified.`,
+		Args: exactArgs("container"),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			settings, err := a.settings(cmd)
+			if err != nil {
+				return err
+			}
+
+			info, err := container.NewInspector(services.NewKSIInspector(), newArchiveService(settings)).Info(args[0])
+			if err != nil {
+				return err
+			}
+
+			if jsonOut {
+				return printJSON(cmd.OutOrStdout(), info)
+			}
+			return printInfo(cmd.OutOrStdout(), info)
+		}),
+	}
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print information as JSON")
+	return cmd
+}
+
+func (a *app) newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect settings",
+	}
+
+	show := &cobra.Command{
+		Use:   "show",
+		Short: "Print effective settings with secrets masked",
+		Long: `Print settings after all layers are applied, secrets are masked.
+
+Use --verbose to list files and environment variables settings were loaded from.
+Invalid settings are printed too and reported afterwards.`,
+		Args: exactArgs(),
+		RunE: a.run(func(cmd *cobra.Command, args []string) error {
+			set, err := a.loadSettings(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := printJSON(cmd.OutOrStdout(), set.masked()); err != nil {
+				return err
+			}
+			return set.validate()
+		}),
+	}
+
+	cmd.AddCommand(show)
+	return cmd
+}
+
+// run marks errors returned by command, so that they are not reported as usage errors.
+func (a *app) run(fn func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := fn(cmd, args); err != nil {
+			return &commandError{err: err}
+		}
+		return nil
+	}
+}
+
+// settings loads and validates settings of the command.
+func (a *app) settings(cmd *cobra.Command) (settings, error) {
+	set, err := a.loadSettings(cmd)
+	if err != nil {
+		return settings{}, err
+	}
+	if err := set.validate(); err != nil {
+		return settings{}, err
+	}
+
+	for _, w := range set.warnings() {
+		fmt.Fprintln(cmd.ErrOrStderr(), "warning:", w)
+	}
+	_, source := password(set.credentials)
+	a.logf(cmd, "KSI password is read from %s", source)
+	for _, agg := range set.Aggregators {
+		_, source := password(agg.credentials)
+		a.logf(cmd, "password of aggregator %s is read from %s", redactURL(agg.Endpoint), source)
+	}
+	return set, nil
+}
+
+func (a *app) loadSettings(cmd *cobra.Command) (settings, error) {
+	set, sources, err := loadSettings(a.configPath, os.LookupEnv)
+	if err != nil {
+		return settings{}, err
+	}
+
+	if len(sources) == 0 {
+		a.logf(cmd, "no settings file found, using defaults")
+	}
+	for _, s := range sources {
+		a.logf(cmd, "settings loaded from %s", s)
+	}
+	return set, nil
+}
+
+// logAggregatorHealth prints health of every aggregator when several of them are used.
+func (a *app) logAggregatorHealth(cmd *cobra.Command, ksiSigner services.KSISigner) {
+	multiSigner, ok := ksiSigner.(*services.MultiKSISigner)
+	if !ok {
+		return
+	}
+
+	for _, h := range multiSigner.Health() {
+		if h.LastError != "" {
+			a.logf(cmd, "aggregator %s: %d signed, %d failed, last error: %s", h.Name, h.Successes, h.Failures, h.LastError)
+		} else {
+			a.logf(cmd, "aggregator %s: %d signed, %d failed", h.Name, h.Successes, h.Failures)
+		}
+	}
+}
+
+// logf prints progress message when --verbose is set.
+func (a *app) logf(cmd *cobra.Command, format string, args ...interface{}) {
+	if a.verbose {
+		fmt.Fprintf(cmd.ErrOrStderr(), format+"\n", args...)
+	}
+}
+
+// batchContainerExtensions are extensions of container files signed by sign-batch in directory.
+var batchContainerExtensions = map[string]bool{".zip": true, ".asice": true, ".sce": true}
+
+// batchContainers returns containers in directory or listed in file, "-" reads list from stdin.
+func batchContainers(source string, stdin io.Reader) ([]string, error) {
+	if source != "-" {
+		fi, err := os.Stat(source)
+		if err != nil {
+			return nil, usageErrorf("container list: %w", err)
+		}
+		if fi.IsDir() {
+			return containersInDir(source)
+		}
+	}
+
+	list := stdin
+	if source != "-" {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, usageErrorf("container list: %w", err)
+		}
+		defer f.Close()
+		list = f
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, usageErrorf("container list: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, usageErrorf("container list %s is empty", source)
+	}
+	return paths, nil
+}
+
+func containersInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, usageErrorf("container directory: %w", err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && batchContainerExtensions[strings.ToLower(filepath.Ext(e.Name()))] {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, usageErrorf("directory %s has no containers", dir)
+	}
+	return paths, nil
+}
+
+// exactArgs requires argument for every name.
+func exactArgs(names ...string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < len(names) {
+			return usageErrorf("missing argument <%s>", names[len(args)])
+		}
+		if len(args) > len(names) {
+			return usageErrorf("unexpected argument '%s'", args[len(names)])
+		}
+		return nil
+	}
+}
+
+func fixedCompletions(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gt/services"
+	"gt/services/container"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// settingsFileName is settings file looked up in working directory.
+	settingsFileName = "settings.json"
+	// envPrefix is prefix of environment variables overriding settings, e.g. GT_ENDPOINT for endpoint.
+	envPrefix = "GT_"
+)
+
+// defaultSettings returns settings used when no layer sets a value.
+func defaultSettings() settings {
+	limits := container.DefaultArchiveLimits()
+	return settings{
+		PublicationsCertEmail: "publications@guardtime.com",
+		VerificationPolicy:    string(services.PolicyKeyBased),
+		ContainerFormat:       string(container.FormatJSON),
+		DataFileHashAlgorithm: "SHA-256",
+		ManifestHashAlgorithm: "SHA-256",
+		ArchiveLimits: &archiveLimitsSettings{
+			MaxEntries:          limits.MaxEntries,
+			MaxTotalSize:        limits.MaxTotalSize,
+			MaxEntrySize:        limits.MaxEntrySize,
+			MaxCompressionRatio: limits.MaxCompressionRatio,
+		},
+		RequestTimeout: "30s",
+		Retry: &retrySettings{
+			Attempts:       3,
+			InitialBackoff: "1s",
+			MaxBackoff:     "10s",
+			Jitter:         0.5,
+		},
+	}
+}
+
+// loadSettings builds settings from layers, later layers override earlier ones:
+// defaults, user config file, settings file in working directory and GT_* environment variables.
+// When configPath is given it replaces both config files and must exist.
+// Returned sources describe layers which were applied.
+func loadSettings(configPath string, lookupEnv func(string) (string, bool)) (settings, []string, error) {
+	set := defaultSettings()
+	var sources []string
+
+	if configPath != "" {
+		if err := readSettingsFile(configPath, &set); err != nil {
+			return settings{}, nil, err
+		}
+		sources = append(sources, configPath)
+	} else {
+		for _, path := range settingsSearchPath(lookupEnv) {
+			err := readSettingsFile(path, &set)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return settings{}, nil, err
+			}
+			sources = append(sources, path)
+		}
+	}
+
+	vars, err := applyEnv(reflect.ValueOf(&set).Elem(), envPrefix, lookupEnv)
+	if err != nil {
+		return settings{}, nil, err
+	}
+	if len(vars) > 0 {
+		sources = append(sources, "environment ("+strings.Join(vars, ", ")+")")
+	}
+
+	return set, sources, nil
+}
+
+// settingsSearchPath returns optional config files in order they are applied.
+func settingsSearchPath(lookupEnv func(string) (string, bool)) []string {
+	var paths []string
+	if dir, ok := lookupEnv("XDG_CONFIG_HOME"); ok && dir != "" {
+		paths = append(paths, filepath.Join(dir, "gt", "config"))
+	} else if home, ok := lookupEnv("HOME"); ok && home != "" {
+		paths = append(paths, filepath.Join(home, ".config", "gt", "config"))
+	}
+	return append(paths, settingsFileName)
+}
+
+// readSettingsFile reads JSON settings file over set, only keys present in file are changed.
+func readSettingsFile(path string, set *settings) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &usageError{err: fmt.Errorf("settings file %s: %w", path, os.ErrNotExist)}
+		}
+		return usageErrorf("settings file %s: %w", path, err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(set); err != nil {
+		var (
+			typeErr   *json.UnmarshalTypeError
+			syntaxErr *json.SyntaxError
+		)
+		switch {
+		case errors.As(err, &typeErr):
+			return usageErrorf("settings file %s: field %s: expected %s, got %s", path, typeErr.Field, typeErr.Type, typeErr.Value)
+		case errors.As(err, &syntaxErr):
+			return usageErrorf("settings file %s: invalid JSON at offset %d: %v", path, syntaxErr.Offset, err)
+		}
+		return usageErrorf("settings file %s: %v", path, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// applyEnv sets fields of struct v from environment variables named after prefix and upper-cased JSON names
+// of the fields, nested structs add their own name to prefix, e.g. GT_ARCHIVE_LIMITS_MAX_ENTRIES.
+// Names of applied variables are returned.
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) ([]string, error) {
+	var applied []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if v.Type().Field(i).Anonymous {
+			// Fields of embedded struct are fields of the parent.
+			vars, err := applyEnv(field, prefix, lookupEnv)
+			if err != nil {
+				return nil, err
+			}
+			applied = append(applied, vars...)
+			continue
+		}
+		name := prefix + strings.ToUpper(jsonName(v.Type().Field(i)))
+
+		if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+			nested := reflect.New(field.Type().Elem())
+			if !field.IsNil() {
+				nested.Elem().Set(field.Elem())
+			}
+
+			vars, err := applyEnv(nested.Elem(), name+"_", lookupEnv)
+			if err != nil {
+				return nil, err
+			}
+			if len(vars) > 0 {
+				field.Set(nested)
+				applied = append(applied, vars...)
+			}
+			continue
+		}
+
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, usageErrorf("environment variable %s: expected true or false, got '%s'", name, value)
+			}
+			field.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, usageErrorf("environment variable %s: expected integer, got '%s'", name, value)
+			}
+			field.SetInt(n)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, usageErrorf("environment variable %s: expected number, got '%s'", name, value)
+			}
+			field.SetFloat(f)
+		default:
+			return nil, usageErrorf("environment variable %s: setting can be given only in settings file", name)
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+func jsonName(f reflect.StructField) string {
+	return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+}
+
+// validate checks every setting and returns error naming every invalid field and its environment variable.
+func (s settings) validate() error {
+	var problems []string
+	check := func(field string, err error) {
+		if err == nil {
+			return
+		}
+		// Fields of lists can be set only in settings file.
+		if strings.Contains(field, "[") {
+			problems = append(problems, fmt.Sprintf("%s: %v", field, err))
+			return
+		}
+		env := envPrefix + strings.ToUpper(strings.Replace(field, ".", "_", -1))
+		problems = append(problems, fmt.Sprintf("%s (%s): %v", field, env, err))
+	}
+
+	check("endpoint", validateURL(s.Endpoint))
+	check("extender_endpoint", validateURL(s.ExtenderEndpoint))
+	check("publications_url", validateURL(s.PublicationsURL))
+	s.credentials.validate("", check)
+
+	for i, a := range s.Aggregators {
+		prefix := fmt.Sprintf("aggregators[%d].", i)
+		if a.Endpoint == "" {
+			check(prefix+"endpoint", errors.New("endpoint is required"))
+		}
+		check(prefix+"endpoint", validateURL(a.Endpoint))
+		a.credentials.validate(prefix, check)
+	}
+	_, err := services.ParseSignerStrategy(s.AggregatorStrategy)
+	check("aggregator_strategy", err)
+	_, err = parseDuration(s.RequestTimeout)
+	check("request_timeout", err)
+	if r := s.Retry; r != nil {
+		if r.Attempts < 1 {
+			check("retry.attempts", fmt.Errorf("must be at least 1, got %d", r.Attempts))
+		}
+		initial, err := parseDuration(r.InitialBackoff)
+		check("retry.initial_backoff", err)
+		max, err := parseDuration(r.MaxBackoff)
+		check("retry.max_backoff", err)
+		if initial > max {
+			check("retry.max_backoff", fmt.Errorf("must not be less than initial_backoff %s, got %s", initial, max))
+		}
+		if r.Jitter < 0 || r.Jitter > 1 {
+			check("retry.jitter", fmt.Errorf("must be in range from 0 to 1, got %v", r.Jitter))
+		}
+	}
+
+	_, err = services.ParseVerificationPolicy(s.VerificationPolicy)
+	check("verification_policy", err)
+	_, err = container.ParseFormat(s.ContainerFormat)
+	check("container_format", err)
+	_, err = services.ParseHashAlgorithm(s.DataFileHashAlgorithm)
+	check("data_file_hash_algorithm", err)
+	_, err = services.ParseHashAlgorithm(s.ManifestHashAlgorithm)
+	check("manifest_hash_algorithm", err)
+
+	if s.WorkDir != "" {
+		if fi, err := os.Stat(s.WorkDir); err != nil {
+			check("work_dir", err)
+		} else if !fi.IsDir() {
+			check("work_dir", fmt.Errorf("'%s' is not a directory", s.WorkDir))
+		}
+	}
+
+	if l := s.ArchiveLimits; l != nil {
+		check("archive_limits.max_entries", validateLimit(int64(l.MaxEntries)))
+		check("archive_limits.max_total_size", validateLimit(l.MaxTotalSize))
+		check("archive_limits.max_entry_size", validateLimit(l.MaxEntrySize))
+		check("archive_limits.max_compression_ratio", validateLimit(l.MaxCompressionRatio))
+	}
+
+	if len(problems) > 0 {
+		return usageErrorf("invalid settings:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// warnings returns problems of settings which are accepted but discouraged.
+func (s settings) warnings() []string {
+	var warnings []string
+	if s.Password != "" {
+		warnings = append(warnings, plaintextPasswordWarning("password"))
+	}
+	for i, a := range s.Aggregators {
+		if a.Password != "" {
+			warnings = append(warnings, plaintextPasswordWarning(fmt.Sprintf("aggregators[%d].password", i)))
+		}
+	}
+	return warnings
+}
+
+func plaintextPasswordWarning(field string) string {
+	return fmt.Sprintf("%s is stored in plain text, use password_env, password_file, password_command or password_keyring instead", field)
+}
+
+func (c credentials) validate(prefix string, check func(field string, err error)) {
+	if sources := passwordSources(c); len(sources) > 1 {
+		check(prefix+"password", fmt.Errorf("only one password source can be set, got %s", strings.Join(sources, ", ")))
+	}
+	if c.PasswordKeyring != nil && c.PasswordKeyring.Socket == "" {
+		check(prefix+"password_keyring.socket", errors.New("keyring agent socket is required"))
+	}
+}
+
+// validateURL accepts empty value, which means that service is not used.
+func validateURL(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	// URL is not printed when it can not be parsed, it may hold credentials.
+	u, err := url.Parse(value)
+	if err != nil {
+		return errors.New("invalid URL")
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid URL '%s'", u.Redacted())
+	}
+	return nil
+}
+
+// parseDuration parses non-negative duration like "1m30s", empty value is zero.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("expected duration like '30s' or '1m', got '%s'", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative, got %s", value)
+	}
+	return d, nil
+}
+
+func validateLimit(value int64) error {
+	if value < 0 {
+		return fmt.Errorf("must not be negative, got %d", value)
+	}
+	return nil
+}
+
+// masked returns copy of settings with secrets replaced, so that they can be printed.
+// Passwords in endpoint URLs are masked too.
+func (s settings) masked() settings {
+	s.credentials = s.credentials.masked()
+	s.Endpoint = redactURL(s.Endpoint)
+	s.Aggregators = append([]aggregatorSettings(nil), s.Aggregators...)
+	for i := range s.Aggregators {
+		s.Aggregators[i].credentials = s.Aggregators[i].credentials.masked()
+		s.Aggregators[i].Endpoint = redactURL(s.Aggregators[i].Endpoint)
+	}
+	s.ExtenderEndpoint = redactURL(s.ExtenderEndpoint)
+	s.PublicationsURL = redactURL(s.PublicationsURL)
+	return s
+}
+
+// masked returns copy of credentials with password and password command replaced,
+// command may hold the password inline, e.g. "echo s3cret".
+func (c credentials) masked() credentials {
+	if c.Password != "" {
+		c.Password = services.SecretMask
+	}
+	if c.PasswordCommand != "" {
+		c.PasswordCommand = services.SecretMask
+	}
+	return c
+}
+
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
@@ -1,113 +1,129 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"gt/services"
 	"gt/services/container"
-	"io/ioutil"
+	"io"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
 )
 
+// Exit codes of the command, 0 is success.
 const (
-	argCommand = iota
-	argCommandFiles
-	argCommandContainerPath
-	argCommandSignatureID
+	exitCodeInvalidContainer  = 1
+	exitCodeError             = 2
+	exitCodeUsage             = 3
+	exitCodeDataFileMissing   = 4
+	exitCodeHashFailed        = 5
+	exitCodeKSI               = 6
+	exitCodeContainerRejected = 7
+	exitCodeSignatureNotFound = 8
+	// exitCodeInterrupted follows shell convention of 128 + SIGINT.
+	exitCodeInterrupted = 130
 )
 
-const (
-	argCommandCreate          = "create"
-	argCommandOpen            = "open"
-	argCommandAddSignature    = "add-signature"
-	argCommandRemoveSignature = "remove-signature"
+var (
+	// errInvalidContainer is returned by verify after report of invalid container is printed.
+	errInvalidContainer = errors.New("container is invalid")
+	// errKSI is returned when KSI service client can not be configured.
+	errKSI = errors.New("ksi error")
 )
 
-func main() {
-	args := os.Args[1:]
-	if len(args) == 0 {
-		fmt.Println("please specify command:", []string{argCommandCreate, argCommandOpen, argCommandRemoveSignature, argCommandAddSignature})
-		os.Exit(-1)
-	}
+// usageError is returned when command is called with invalid arguments, flags or settings.
+type usageError struct {
+	err error
+}
 
-	settings, err := readsettings()
-	if err != nil {
-		fmt.Println("failed to load settings")
-		os.Exit(-1)
-	}
+func (e *usageError) Error() string { return e.err.Error() }
 
-	ksiSigner, err := services.NewKSISigner(settings.Endpoint, settings.Username, settings.Password)
-	if err != nil {
-		fmt.Println("ksi error:", err)
-		os.Exit(-1)
-	}
+func (e *usageError) Unwrap() error { return e.err }
 
-	sigCreator := container.NewSignatureCreator(ksiSigner)
-	archiveService := container.NewZipArchiveService()
-	signer := container.NewSigner(sigCreator, archiveService)
-	creator := container.NewCreator(sigCreator, archiveService)
+func usageErrorf(format string, a ...interface{}) error {
+	return &usageError{err: fmt.Errorf(format, a...)}
+}
 
-	cmd := args[0]
-	switch cmd {
-	case argCommandCreate:
-		filepaths := strings.Split(args[2], ",")
+// commandError marks errors returned by command itself, other errors come from parsing command line.
+type commandError struct {
+	err error
+}
 
-		if err := creator.Create(filepaths, args[1]); err != nil {
-			fmt.Println("error:", err)
-			os.Exit(-1)
-		}
-	case argCommandOpen:
-		paths, err := archiveService.Extract(args[1])
-		if err != nil {
-			fmt.Println("error", err)
-			os.Exit(-1)
-		}
-		fmt.Println("extacted container files: ", paths)
-	case argCommandAddSignature:
-		if err := signer.AddSignature(args[1]); err != nil {
-			fmt.Println("error", err)
-			os.Exit(-1)
-		}
-	case argCommandRemoveSignature:
-		i, err := strconv.Atoi(args[2])
-		if err != nil {
-			fmt.Println("invalid int provided as index:", args[2])
-			os.Exit(-1)
-		}
+func (e *commandError) Error() string { return e.err.Error() }
 
-		if err := signer.RemoveSignature(args[1], i); err != nil {
-			fmt.Println("error", err)
-			os.Exit(-1)
-		}
-	default:
-		fmt.Println("unknown command")
-		os.Exit(-1)
-	}
-}
+func (e *commandError) Unwrap() error { return e.err }
 
-type settings struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Endpoint string `json:"endpoint"`
-}
+func main() {
+	// First interrupt cancels the command, which removes its partial work, the second one kills it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-func readsettings() (settings, error) {
-	f, err := os.Open("settings.json")
-	if err != nil {
-		return settings{}, err
+	root := newRootCommand()
+	cmd, err := root.ExecuteContextC(ctx)
+	stop()
+	if err == nil {
+		return
 	}
 
-	bs, err := ioutil.ReadAll(f)
-	if err != nil {
-		return settings{}, err
+	code := exitCode(err)
+	switch {
+	case errors.Is(err, errInvalidContainer):
+		// Verification report is already printed.
+	case !errors.As(err, new(*commandError)):
+		fmt.Fprintln(os.Stderr, "error:", err)
+		fmt.Fprint(os.Stderr, cmd.UsageString())
+	default:
+		printError(os.Stderr, err)
 	}
+	os.Exit(code)
+}
 
-	var set settings
-	if err := json.Unmarshal(bs, &set); err != nil {
-		return settings{}, err
+// printError prints error, containers rejected by archive checks are reported separately.
+func printError(w io.Writer, err error) {
+	var entryErr *container.ArchiveEntryError
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(w, "interrupted, no changes were made")
+	case errors.As(err, &entryErr):
+		fmt.Fprintf(w, "container rejected: entry '%s': %s\n", entryErr.Name, entryErr.Err)
+	case errors.Is(err, container.ErrTooManyEntries), errors.Is(err, container.ErrArchiveTooLarge):
+		fmt.Fprintln(w, "container rejected:", err)
+	default:
+		fmt.Fprintln(w, "error:", err)
 	}
+}
 
-	return set, nil
+func exitCode(err error) int {
+	var (
+		entryErr *container.ArchiveEntryError
+		usageErr *usageError
+		cmdErr   *commandError
+	)
+	switch {
+	case errors.As(err, &usageErr):
+		return exitCodeUsage
+	case !errors.As(err, &cmdErr):
+		// Unknown commands and flags and invalid arguments are reported by command line parser.
+		return exitCodeUsage
+	case errors.Is(err, context.Canceled):
+		return exitCodeInterrupted
+	case errors.Is(err, errInvalidContainer):
+		return exitCodeInvalidContainer
+	case errors.Is(err, container.ErrDataFileMissing):
+		return exitCodeDataFileMissing
+	case errors.Is(err, container.ErrHashFailed):
+		return exitCodeHashFailed
+	case errors.Is(err, errKSI), errors.Is(err, container.ErrKSISign), errors.Is(err, container.ErrKSIExtend):
+		return exitCodeKSI
+	case errors.As(err, &entryErr), errors.Is(err, container.ErrTooManyEntries), errors.Is(err, container.ErrArchiveTooLarge):
+		return exitCodeContainerRejected
+	case errors.Is(err, container.ErrSignatureNotFound):
+		return exitCodeSignatureNotFound
+	case errors.Is(err, container.ErrUnsupportedHashAlgo):
+		return exitCodeUsage
+	}
+	return exitCodeError
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gt/services/container"
+	"io/ioutil"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	cmdErr := func(err error) error { return &commandError{err: fmt.Errorf("command failed: %w", err)} }
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "parser error", err: errors.New(`unknown flag: --foo`), expected: exitCodeUsage},
+		{name: "usage error", err: usageErrorf("missing command"), expected: exitCodeUsage},
+		{name: "usage error of command", err: cmdErr(usageErrorf("invalid settings")), expected: exitCodeUsage},
+		{name: "interrupted", err: cmdErr(context.Canceled), expected: exitCodeInterrupted},
+		{name: "invalid container", err: cmdErr(errInvalidContainer), expected: exitCodeInvalidContainer},
+		{name: "data file missing", err: cmdErr(container.ErrDataFileMissing), expected: exitCodeDataFileMissing},
+		{name: "hash failed", err: cmdErr(container.ErrHashFailed), expected: exitCodeHashFailed},
+		{name: "KSI configuration", err: cmdErr(errKSI), expected: exitCodeKSI},
+		{name: "KSI signing", err: cmdErr(container.ErrKSISign), expected: exitCodeKSI},
+		{name: "KSI extending", err: cmdErr(container.ErrKSIExtend), expected: exitCodeKSI},
+		{name: "unsafe entry", err: cmdErr(&container.ArchiveEntryError{Name: "../a", Err: errors.New("unsafe path")}), expected: exitCodeContainerRejected},
+		{name: "too many entries", err: cmdErr(container.ErrTooManyEntries), expected: exitCodeContainerRejected},
+		{name: "archive too large", err: cmdErr(container.ErrArchiveTooLarge), expected: exitCodeContainerRejected},
+		{name: "signature not found", err: cmdErr(container.ErrSignatureNotFound), expected: exitCodeSignatureNotFound},
+		{name: "unsupported hash algorithm", err: cmdErr(container.ErrUnsupportedHashAlgo), expected: exitCodeUsage},
+		{name: "other error", err: cmdErr(errors.New("disk full")), expected: exitCodeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			code := exitCode(tt.err)
+
+			// Assert
+			if code != tt.expected {
+				t.Fatalf("expected exit code %d, got %d", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestRootCommand_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{name: "no command", args: nil, expected: exitCodeUsage},
+		{name: "unknown command", args: []string{"sing"}, expected: exitCodeUsage},
+		{name: "unknown flag", args: []string{"verify", "--foo"}, expected: exitCodeUsage},
+		{name: "missing argument", args: []string{"verify"}, expected: exitCodeUsage},
+		{name: "help", args: []string{"--help"}, expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRootCommand()
+			root.SetArgs(tt.args)
+			root.SetOut(ioutil.Discard)
+			root.SetErr(ioutil.Discard)
+
+			// Act
+			err := root.Execute()
+
+			// Assert
+			code := 0
+			if err != nil {
+				code = exitCode(err)
+			}
+			if code != tt.expected {
+				t.Fatalf("expected exit code %d, got %d: %v", tt.expected, code, err)
+			}
+		})
+	}
+}
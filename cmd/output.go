@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gt/services/container"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func printVerificationReport(w io.Writer, report container.VerificationReport) {
+	fmt.Fprintln(w, "container format:", report.Format)
+	if len(report.Signatures) == 0 {
+		fmt.Fprintln(w, "container has no signatures")
+	}
+
+	for _, sig := range report.Signatures {
+		fmt.Fprintf(w, "signature %v (%s): %s\n", sig.ID, sig.ManifestUri, resultString(sig.Err))
+		if sig.KSIResult.Policy != "" {
+			fmt.Fprintf(w, "  policy %s: %s %s\n", sig.KSIResult.Policy, sig.KSIResult.Code, sig.KSIResult.Reason)
+		}
+		if sig.KSIResult.DeprecatedHashAlgorithm {
+			fmt.Fprintf(w, "  warning: manifest is hashed with deprecated algorithm %s\n", sig.KSIResult.HashAlgorithm)
+		}
+		for _, f := range sig.Files {
+			fmt.Fprintf(w, "  %s: %s\n", f.Uri, resultString(f.Err))
+			if f.DeprecatedHashAlgorithm {
+				fmt.Fprintf(w, "  warning: %s is hashed with deprecated algorithm %s\n", f.Uri, f.HashAlgorithm)
+			}
+		}
+		for _, m := range sig.PreviousManifests {
+			if m.Missing {
+				fmt.Fprintf(w, "  warning: previous manifest %s is missing, its signature was removed\n", m.Uri)
+				continue
+			}
+			fmt.Fprintf(w, "  previous manifest %s: %s\n", m.Uri, resultString(m.Err))
+		}
+	}
+
+	for _, f := range report.Coverage {
+		if len(f.SignatureIDs) > 0 {
+			fmt.Fprintf(w, "file %s: signed by %s\n", f.Uri, joinInts(f.SignatureIDs, ", "))
+		}
+	}
+
+	for _, uri := range report.UnsignedFiles {
+		fmt.Fprintf(w, "unsigned file: %s\n", uri)
+	}
+
+	switch {
+	case report.Valid() && report.InternalOnly():
+		fmt.Fprintln(w, "container is internally consistent, signatures were not verified against any trust anchor (internal policy)")
+	case report.Valid():
+		fmt.Fprintln(w, "container is valid")
+	default:
+		fmt.Fprintln(w, "container is invalid")
+	}
+}
+
+// verificationReportJSON is JSON form of container.VerificationReport, errors are kept as messages.
+type verificationReportJSON struct {
+	Format        container.Format         `json:"format"`
+	Valid         bool                     `json:"valid"`
+	Policy        string                   `json:"policy"`
+	InternalOnly  bool                     `json:"internal_only,omitempty"`
+	Signatures    []signatureReportJSON    `json:"signatures"`
+	Coverage      []container.FileCoverage `json:"coverage"`
+	UnsignedFiles []string                 `json:"unsigned_files"`
+}
+
+type signatureReportJSON struct {
+	ID                      int                  `json:"id"`
+	ManifestUri             string               `json:"manifest_uri"`
+	SignatureUri            string               `json:"signature_uri"`
+	Valid                   bool                 `json:"valid"`
+	Error                   string               `json:"error,omitempty"`
+	Policy                  string               `json:"policy,omitempty"`
+	Code                    string               `json:"code,omitempty"`
+	Reason                  string               `json:"reason,omitempty"`
+	HashAlgorithm           string               `json:"hash_algorithm,omitempty"`
+	DeprecatedHashAlgorithm bool                 `json:"deprecated_hash_algorithm,omitempty"`
+	Files                   []dataFileReportJSON `json:"files"`
+	PreviousManifests       []manifestRefJSON    `json:"previous_manifests,omitempty"`
+}
+
+type manifestRefJSON struct {
+	Uri     string `json:"uri"`
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type dataFileReportJSON struct {
+	Uri                     string `json:"uri"`
+	HashAlgorithm           string `json:"hash_algorithm"`
+	DeprecatedHashAlgorithm bool   `json:"deprecated_hash_algorithm,omitempty"`
+	Error                   string `json:"error,omitempty"`
+}
+
+func printVerificationReportJSON(w io.Writer, report container.VerificationReport) error {
+	out := verificationReportJSON{
+		Format:        report.Format,
+		Valid:         report.Valid(),
+		Policy:        string(report.Policy),
+		InternalOnly:  report.InternalOnly(),
+		Signatures:    make([]signatureReportJSON, 0, len(report.Signatures)),
+		Coverage:      report.Coverage,
+		UnsignedFiles: report.UnsignedFiles,
+	}
+
+	for _, sig := range report.Signatures {
+		s := signatureReportJSON{
+			ID:                      sig.ID,
+			ManifestUri:             sig.ManifestUri,
+			SignatureUri:            sig.SignatureUri,
+			Valid:                   sig.Valid(),
+			Error:                   errorString(sig.Err),
+			Policy:                  sig.KSIResult.Policy,
+			Code:                    sig.KSIResult.Code,
+			Reason:                  sig.KSIResult.Reason,
+			HashAlgorithm:           sig.KSIResult.HashAlgorithm,
+			DeprecatedHashAlgorithm: sig.KSIResult.DeprecatedHashAlgorithm,
+			Files:                   make([]dataFileReportJSON, 0, len(sig.Files)),
+		}
+		for _, f := range sig.Files {
+			s.Files = append(s.Files, dataFileReportJSON{
+				Uri:                     f.Uri,
+				HashAlgorithm:           f.HashAlgorithm,
+				DeprecatedHashAlgorithm: f.DeprecatedHashAlgorithm,
+				Error:                   errorString(f.Err),
+			})
+		}
+		for _, m := range sig.PreviousManifests {
+			s.PreviousManifests = append(s.PreviousManifests, manifestRefJSON{Uri: m.Uri, Missing: m.Missing, Error: errorString(m.Err)})
+		}
+		out.Signatures = append(out.Signatures, s)
+	}
+
+	return printJSON(w, out)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func printInfo(out io.Writer, info container.ContainerInfo) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "container format: %s\n\n", info.Format)
+	fmt.Fprintln(w, "FILE\tSIZE\tHASH")
+	for _, f := range info.DataFiles {
+		fmt.Fprintf(w, "%s\t%d\t%s:%s\n", f.Uri, f.Size, f.HashAlgorithm, f.Hash)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "SIGNATURE\tMANIFEST\tFILES\tALGORITHM\tSIGNING TIME\tIDENTITY\tEXTENDED\tPUBLICATION")
+	for _, sig := range info.Signatures {
+		signingTime, identity, extended, publication := "-", "-", "-", "-"
+		if sig.KSI != nil {
+			signingTime = sig.KSI.SigningTime.UTC().Format(time.RFC3339)
+			identity = strings.Join(sig.KSI.Identity, " :: ")
+			extended = strconv.FormatBool(sig.KSI.Extended)
+			if sig.KSI.PublicationTime != nil {
+				publication = sig.KSI.PublicationTime.UTC().Format(publicationDateLayout)
+			}
+		}
+
+		fmt.Fprintf(w, "%v\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sig.ID, sig.ManifestUri, strings.Join(sig.Files, ","),
+			strings.Join(sig.HashAlgorithms, ","), signingTime, identity, extended, publication)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, sig := range info.Signatures {
+		if sig.ManifestVersion != "" {
+			fmt.Fprintf(out, "signature %v: manifest version %s", sig.ID, sig.ManifestVersion)
+			if sig.Created != nil {
+				fmt.Fprintf(out, ", created %s", sig.Created.UTC().Format(time.RFC3339))
+			}
+			if sig.Tool != "" {
+				fmt.Fprintf(out, " by %s", sig.Tool)
+			}
+			fmt.Fprintln(out)
+		}
+		if len(sig.PreviousManifests) > 0 {
+			uris := make([]string, 0, len(sig.PreviousManifests))
+			for _, m := range sig.PreviousManifests {
+				uris = append(uris, m.Uri)
+			}
+			fmt.Fprintf(out, "signature %v: previous manifests %s\n", sig.ID, strings.Join(uris, ", "))
+		}
+		if sig.Signer != nil {
+			fmt.Fprintf(out, "signature %v: signer claims name '%s', role '%s', reason '%s'\n", sig.ID, sig.Signer.Name, sig.Signer.Role, sig.Signer.Reason)
+		}
+		if sig.Error != "" {
+			fmt.Fprintf(out, "signature %v: %s\n", sig.ID, sig.Error)
+		}
+	}
+	return nil
+}
+
+// printDanglingReferences warns about manifests which refer to manifest of removed signature.
+func printDanglingReferences(w io.Writer, sigs []container.SignatureInfo, removedID int) {
+	var removed string
+	for _, sig := range sigs {
+		if sig.ID == removedID {
+			removed = sig.ManifestUri
+		}
+	}
+
+	for _, sig := range sigs {
+		for _, m := range sig.PreviousManifests {
+			if sig.ID != removedID && m.Uri == removed {
+				fmt.Fprintf(w, "warning: signature %v refers to removed manifest %s in its previous manifests\n", sig.ID, removed)
+			}
+		}
+	}
+}
+
+func joinInts(values []int, sep string) string {
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		strs = append(strs, strconv.Itoa(v))
+	}
+	return strings.Join(strs, sep)
+}
+
+func resultString(err error) string {
+	if err != nil {
+		return fmt.Sprintf("FAILED (%s)", err)
+	}
+	return "OK"
+}
+
+func errorString(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
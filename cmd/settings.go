@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"gt/domain/manifest"
+	"gt/services"
+	"gt/services/container"
+	"sort"
+
+	"github.com/guardtime/goksi/hash"
+)
+
+type settings struct {
+	credentials
+	// Endpoint is aggregator used with credentials above, it is tried before Aggregators.
+	Endpoint string `json:"endpoint"`
+	// Aggregators are further aggregator endpoints with their own credentials.
+	Aggregators []aggregatorSettings `json:"aggregators"`
+	// AggregatorStrategy is "failover" or "race", it applies when more than one aggregator is set.
+	AggregatorStrategy    string `json:"aggregator_strategy"`
+	ExtenderEndpoint      string `json:"extender_endpoint"`
+	PublicationsURL       string `json:"publications_url"`
+	PublicationsFile      string `json:"publications_file"`
+	PublicationsCertEmail string `json:"publications_cert_email"`
+	VerificationPolicy    string `json:"verification_policy"`
+	ContainerFormat       string `json:"container_format"`
+	DataFileHashAlgorithm string `json:"data_file_hash_algorithm"`
+	ManifestHashAlgorithm string `json:"manifest_hash_algorithm"`
+	// WorkDir is root of extraction workspaces of open, directory for temporary files is used when empty.
+	WorkDir string `json:"work_dir"`
+	// Signer claims are recorded in every created manifest.
+	Signer *manifest.SignerClaims `json:"signer"`
+	// Backup keeps previous container as ".bak" file when container is rewritten.
+	Backup bool `json:"backup"`
+	// ArchiveLimits restricts accepted containers, zero value disables a limit.
+	ArchiveLimits *archiveLimitsSettings `json:"archive_limits"`
+	// RequestTimeout limits every signing request, e.g. "30s". Zero disables the limit.
+	RequestTimeout string `json:"request_timeout"`
+	// Retry repeats signing requests which failed with network or temporary service errors.
+	Retry *retrySettings `json:"retry"`
+}
+
+// credentials authenticate to KSI service, only one password source can be set.
+type credentials struct {
+	Username string `json:"username"`
+	// Password in plain text is discouraged, use one of password sources below instead.
+	Password string `json:"password"`
+	// PasswordEnv names environment variable holding the password.
+	PasswordEnv string `json:"password_env"`
+	// PasswordFile is file holding the password, it must be readable by owner only.
+	PasswordFile string `json:"password_file"`
+	// PasswordCommand is shell command printing the password.
+	PasswordCommand string `json:"password_command"`
+	// PasswordKeyring reads the password from OS keyring through local agent.
+	PasswordKeyring *keyringSettings `json:"password_keyring"`
+}
+
+type aggregatorSettings struct {
+	Endpoint string `json:"endpoint"`
+	credentials
+}
+
+type keyringSettings struct {
+	// Socket is unix socket of keyring agent.
+	Socket string `json:"socket"`
+	// Service defaults to "gt".
+	Service string `json:"service"`
+	// Account defaults to username.
+	Account string `json:"account"`
+}
+
+type retrySettings struct {
+	// Attempts is maximum number of requests, 1 disables retries.
+	Attempts int `json:"attempts"`
+	// InitialBackoff is delay before the first retry, it is doubled for every next retry up to MaxBackoff.
+	InitialBackoff string `json:"initial_backoff"`
+	MaxBackoff     string `json:"max_backoff"`
+	// Jitter is fraction in range [0, 1] by which delays are randomly shortened.
+	Jitter float64 `json:"jitter"`
+}
+
+type archiveLimitsSettings struct {
+	MaxEntries          int   `json:"max_entries"`
+	MaxTotalSize        int64 `json:"max_total_size"`
+	MaxEntrySize        int64 `json:"max_entry_size"`
+	MaxCompressionRatio int64 `json:"max_compression_ratio"`
+}
+
+func newArchiveService(settings settings) container.ZipArchiveService {
+	return container.NewZipArchiveService(
+		container.ZipArchiveOptLimits(archiveLimits(settings)),
+		container.ZipArchiveOptWorkDir(settings.WorkDir),
+	)
+}
+
+// defaultKeyringService is keyring service of the password when settings do not name one.
+const defaultKeyringService = "gt"
+
+// password returns source of KSI password and its description, which never contains the password.
+func password(c credentials) (services.SecretProvider, string) {
+	switch {
+	case c.PasswordEnv != "":
+		return services.EnvSecret(c.PasswordEnv), "environment variable " + c.PasswordEnv
+	case c.PasswordFile != "":
+		return services.FileSecret(c.PasswordFile), "file " + c.PasswordFile
+	case c.PasswordCommand != "":
+		return services.CommandSecret(c.PasswordCommand), "command"
+	case c.PasswordKeyring != nil:
+		k := *c.PasswordKeyring
+		if k.Service == "" {
+			k.Service = defaultKeyringService
+		}
+		if k.Account == "" {
+			k.Account = c.Username
+		}
+		return services.KeyringSecret(k.Socket, k.Service, k.Account), "keyring agent " + k.Socket
+	}
+	return services.StaticSecret(c.Password), "settings"
+}
+
+// passwordSources returns names of password settings which are set.
+func passwordSources(c credentials) []string {
+	var names []string
+	for name, set := range map[string]bool{
+		"password":         c.Password != "",
+		"password_env":     c.PasswordEnv != "",
+		"password_file":    c.PasswordFile != "",
+		"password_command": c.PasswordCommand != "",
+		"password_keyring": c.PasswordKeyring != nil,
+	} {
+		if set {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// aggregators returns every configured aggregator in order of preference.
+func aggregators(settings settings) []aggregatorSettings {
+	var all []aggregatorSettings
+	if settings.Endpoint != "" {
+		all = append(all, aggregatorSettings{Endpoint: settings.Endpoint, credentials: settings.credentials})
+	}
+	return append(all, settings.Aggregators...)
+}
+
+// newKSISigner returns signer of the only aggregator or signer which uses every aggregator by aggregator strategy.
+// Every request is limited by request timeout, retries are added by newSignatureCreator.
+func newKSISigner(settings settings) (services.KSISigner, error) {
+	// Settings are validated before use.
+	requestTimeout, _ := parseDuration(settings.RequestTimeout)
+	timeout := services.KSISignerOptTimeout(requestTimeout)
+
+	all := aggregators(settings)
+	if len(all) <= 1 {
+		a := aggregatorSettings{credentials: settings.credentials}
+		if len(all) == 1 {
+			a = all[0]
+		}
+		pswd, _ := password(a.credentials)
+		ksiSigner, err := services.NewKSISigner(a.Endpoint, a.Username, pswd, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errKSI, err)
+		}
+		return ksiSigner, nil
+	}
+
+	endpoints := make([]services.SignerEndpoint, 0, len(all))
+	for _, a := range all {
+		pswd, _ := password(a.credentials)
+		ksiSigner, err := services.NewKSISigner(a.Endpoint, a.Username, pswd, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: aggregator %s: %v", errKSI, redactURL(a.Endpoint), err)
+		}
+		endpoints = append(endpoints, services.SignerEndpoint{Name: redactURL(a.Endpoint), Signer: ksiSigner})
+	}
+
+	strategy, err := services.ParseSignerStrategy(settings.AggregatorStrategy)
+	if err != nil {
+		return nil, &usageError{err: err}
+	}
+	multiSigner, err := services.NewMultiKSISigner(endpoints, services.MultiSignerOptStrategy(strategy))
+	if err != nil {
+		return nil, err
+	}
+	return multiSigner, nil
+}
+
+func newSignatureCreator(settings settings, ksiSigner services.KSISigner) container.SignatureCreator {
+	var claims manifest.SignerClaims
+	if settings.Signer != nil {
+		claims = *settings.Signer
+	}
+
+	return container.NewSignatureCreator(retryingSigner(settings, ksiSigner), container.SignatureCreatorOptSignerClaims(claims))
+}
+
+// retryingSigner returns signer which repeats transient failures of ksiSigner as set by retry settings.
+func retryingSigner(settings settings, ksiSigner services.KSISigner) services.KSISigner {
+	r := settings.Retry
+	if r == nil || r.Attempts <= 1 {
+		return ksiSigner
+	}
+
+	// Settings are validated before use.
+	initial, _ := parseDuration(r.InitialBackoff)
+	max, _ := parseDuration(r.MaxBackoff)
+	return services.NewRetryingKSISigner(ksiSigner,
+		services.RetryOptAttempts(r.Attempts),
+		services.RetryOptBackoff(initial, max),
+		services.RetryOptJitter(r.Jitter),
+	)
+}
+
+// archiveLimits returns limits from settings, default limits are used when settings do not have them.
+func archiveLimits(settings settings) container.ArchiveLimits {
+	if settings.ArchiveLimits == nil {
+		return container.DefaultArchiveLimits()
+	}
+
+	return container.ArchiveLimits{
+		MaxEntries:          settings.ArchiveLimits.MaxEntries,
+		MaxTotalSize:        settings.ArchiveLimits.MaxTotalSize,
+		MaxEntrySize:        settings.ArchiveLimits.MaxEntrySize,
+		MaxCompressionRatio: settings.ArchiveLimits.MaxCompressionRatio,
+	}
+}
+
+func hashAlgorithms(settings settings) (dataFile, manifest hash.Algorithm, err error) {
+	dataFile, err = services.ParseHashAlgorithm(settings.DataFileHashAlgorithm)
+	if err != nil {
+		return hash.Algorithm(0), hash.Algorithm(0), &usageError{err: err}
+	}
+
+	manifest, err = services.ParseHashAlgorithm(settings.ManifestHashAlgorithm)
+	if err != nil {
+		return hash.Algorithm(0), hash.Algorithm(0), &usageError{err: err}
+	}
+
+	return dataFile, manifest, nil
+}
+
+func newKSIVerifier(settings settings) (services.KSIVerifier, error) {
+	pswd, _ := password(settings.credentials)
+	ksiVerifier, err := services.NewKSIVerifier(services.KSIVerifierConfig{
+		ExtenderEndpoint:      settings.ExtenderEndpoint,
+		Username:              settings.Username,
+		Password:              pswd,
+		PublicationsFileURL:   settings.PublicationsURL,
+		PublicationsFilePath:  settings.PublicationsFile,
+		PublicationsCertEmail: settings.PublicationsCertEmail,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errKSI, err)
+	}
+
+	return ksiVerifier, nil
+}
+
+func newKSIExtender(settings settings) (services.KSIExtender, error) {
+	pswd, _ := password(settings.credentials)
+	ksiExtender, err := services.NewKSIExtender(settings.ExtenderEndpoint, settings.Username, pswd, settings.PublicationsURL, settings.PublicationsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errKSI, err)
+	}
+
+	return ksiExtender, nil
+}
@@ -0,0 +1,199 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const timestampTokenMimeType = "application/vnd.etsi.timestamp-token"
+
+// digestMethods maps hash algorithm names used in Model to XML digest method URIs.
+// Canonical name of an algorithm comes before its aliases.
+var digestMethods = []struct {
+	name string
+	uri  string
+}{
+	{"SHA-1", "http://www.w3.org/2000/09/xmldsig#sha1"},
+	{"SHA1", "http://www.w3.org/2000/09/xmldsig#sha1"},
+	{"SHA-256", "http://www.w3.org/2001/04/xmlenc#sha256"},
+	{"SHA256", "http://www.w3.org/2001/04/xmlenc#sha256"},
+	{"RIPEMD-160", "http://www.w3.org/2001/04/xmlenc#ripemd160"},
+	{"SHA-384", "http://www.w3.org/2001/04/xmldsig-more#sha384"},
+	{"SHA384", "http://www.w3.org/2001/04/xmldsig-more#sha384"},
+	{"SHA-512", "http://www.w3.org/2001/04/xmlenc#sha512"},
+	{"SHA512", "http://www.w3.org/2001/04/xmlenc#sha512"},
+	{"SHA3-224", "http://www.w3.org/2007/05/xmldsig-more#sha3-224"},
+	{"SHA3-256", "http://www.w3.org/2007/05/xmldsig-more#sha3-256"},
+	{"SHA3-384", "http://www.w3.org/2007/05/xmldsig-more#sha3-384"},
+	{"SHA3-512", "http://www.w3.org/2007/05/xmldsig-more#sha3-512"},
+}
+
+// ASiCManifest defines ASiC-E manifest (ETSI EN 319 162-1) structure
+type ASiCManifest struct {
+	XMLName              xml.Name              `xml:"http://uri.etsi.org/02918/v1.2.1# ASiCManifest"`
+	SigReference         SigReference          `xml:"http://uri.etsi.org/02918/v1.2.1# SigReference"`
+	DataObjectReferences []DataObjectReference `xml:"http://uri.etsi.org/02918/v1.2.1# DataObjectReference"`
+	Extensions           *ManifestExtensions   `xml:"http://uri.etsi.org/02918/v1.2.1# ASiCManifestExtensions,omitempty"`
+}
+
+// ManifestExtensions holds extensions of ASiC-E manifest
+type ManifestExtensions struct {
+	Extensions []Extension `xml:"http://uri.etsi.org/02918/v1.2.1# Extension"`
+}
+
+// Extension holds manifest metadata which has no place in ASiC-E manifest. Other extensions are ignored.
+type Extension struct {
+	Critical bool      `xml:"Critical,attr"`
+	Metadata *Metadata `xml:"urn:guardtime:gt:manifest Metadata,omitempty"`
+}
+
+// Metadata holds Model fields which are not part of ASiC-E manifest
+type Metadata struct {
+	Version           string              `xml:"urn:guardtime:gt:manifest Version"`
+	Created           *time.Time          `xml:"urn:guardtime:gt:manifest Created,omitempty"`
+	Tool              string              `xml:"urn:guardtime:gt:manifest Tool,omitempty"`
+	Signer            *SignerClaims       `xml:"urn:guardtime:gt:manifest Signer,omitempty"`
+	Files             []FileMetadata      `xml:"urn:guardtime:gt:manifest File"`
+	PreviousManifests []ManifestReference `xml:"urn:guardtime:gt:manifest PreviousManifest"`
+}
+
+// FileMetadata holds size of data file
+type FileMetadata struct {
+	URI  string `xml:"URI,attr"`
+	Size int64  `xml:"Size,attr"`
+}
+
+// SigReference points to timestamp token which covers the manifest
+type SigReference struct {
+	URI      string `xml:"URI,attr"`
+	MimeType string `xml:"MimeType,attr,omitempty"`
+}
+
+// DataObjectReference points to associated file in container
+type DataObjectReference struct {
+	URI          string       `xml:"URI,attr"`
+	MimeType     string       `xml:"MimeType,attr,omitempty"`
+	DigestMethod DigestMethod `xml:"http://www.w3.org/2000/09/xmldsig# DigestMethod"`
+	DigestValue  string       `xml:"http://www.w3.org/2000/09/xmldsig# DigestValue"`
+}
+
+// DigestMethod holds digest algorithm URI
+type DigestMethod struct {
+	Algorithm string `xml:"Algorithm,attr"`
+}
+
+// ASiC converts manifest to ASiC-E manifest. KSI signature is referenced as timestamp token.
+// Fields which ASiC-E manifest does not have are kept in non-critical extension.
+func (m Model) ASiC() (ASiCManifest, error) {
+	asic := ASiCManifest{
+		SigReference: SigReference{URI: m.SignatureUri, MimeType: timestampTokenMimeType},
+	}
+
+	metadata := Metadata{
+		Version:           m.Version,
+		Created:           m.Created,
+		Tool:              m.Tool,
+		Signer:            m.Signer,
+		PreviousManifests: m.PreviousManifests,
+	}
+
+	for _, f := range m.Files {
+		alg := digestMethodURI(f.HashAlgorithm)
+		if alg == "" {
+			return ASiCManifest{}, fmt.Errorf("no digest method for hash algorithm '%s'", f.HashAlgorithm)
+		}
+
+		digest, err := hex.DecodeString(f.Hash)
+		if err != nil {
+			return ASiCManifest{}, fmt.Errorf("invalid hash of '%s': %w", f.Uri, err)
+		}
+
+		asic.DataObjectReferences = append(asic.DataObjectReferences, DataObjectReference{
+			URI:          f.Uri,
+			MimeType:     f.MimeType,
+			DigestMethod: DigestMethod{Algorithm: alg},
+			DigestValue:  base64.StdEncoding.EncodeToString(digest),
+		})
+
+		if f.Size > 0 {
+			metadata.Files = append(metadata.Files, FileMetadata{URI: f.Uri, Size: f.Size})
+		}
+	}
+
+	// Manifests without version have no metadata.
+	if m.Version != "" {
+		asic.Extensions = &ManifestExtensions{Extensions: []Extension{{Metadata: &metadata}}}
+	}
+	return asic, nil
+}
+
+// Model converts ASiC-E manifest to manifest model. Unknown digest methods are kept as algorithm URIs.
+func (a ASiCManifest) Model() (Model, error) {
+	m := Model{
+		Files:        make([]DataFile, 0, len(a.DataObjectReferences)),
+		SignatureUri: a.SigReference.URI,
+	}
+
+	sizes := make(map[string]int64)
+	if metadata := a.metadata(); metadata != nil {
+		m.Version = metadata.Version
+		m.Created = metadata.Created
+		m.Tool = metadata.Tool
+		m.Signer = metadata.Signer
+		m.PreviousManifests = metadata.PreviousManifests
+		for _, f := range metadata.Files {
+			sizes[f.URI] = f.Size
+		}
+	}
+
+	for _, ref := range a.DataObjectReferences {
+		digest, err := base64.StdEncoding.DecodeString(ref.DigestValue)
+		if err != nil {
+			return Model{}, fmt.Errorf("invalid digest of '%s': %w", ref.URI, err)
+		}
+
+		m.Files = append(m.Files, DataFile{
+			Uri:           ref.URI,
+			HashAlgorithm: hashAlgorithmName(ref.DigestMethod.Algorithm),
+			Hash:          hex.EncodeToString(digest),
+			Size:          sizes[ref.URI],
+			MimeType:      ref.MimeType,
+		})
+	}
+	return m, nil
+}
+
+func (a ASiCManifest) metadata() *Metadata {
+	if a.Extensions == nil {
+		return nil
+	}
+
+	for _, e := range a.Extensions.Extensions {
+		if e.Metadata != nil {
+			return e.Metadata
+		}
+	}
+	return nil
+}
+
+func digestMethodURI(name string) string {
+	for _, m := range digestMethods {
+		if strings.EqualFold(m.name, name) {
+			return m.uri
+		}
+	}
+	return ""
+}
+
+func hashAlgorithmName(digestMethod string) string {
+	for _, m := range digestMethods {
+		if m.uri == digestMethod {
+			return m.name
+		}
+	}
+	return digestMethod
+}
@@ -0,0 +1,223 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// CanonicalVersion is the first schema version whose manifests are serialized canonically.
+const CanonicalVersion = "1.1"
+
+var ErrNotCanonical = errors.New("manifest is not in canonical form")
+
+// Sorted returns copy of the manifest with files and previous manifests sorted by uri.
+func (m Model) Sorted() Model {
+	m.Files = append([]DataFile(nil), m.Files...)
+	sort.SliceStable(m.Files, func(i, j int) bool {
+		return m.Files[i].Uri < m.Files[j].Uri
+	})
+
+	if m.PreviousManifests != nil {
+		m.PreviousManifests = append([]ManifestReference(nil), m.PreviousManifests...)
+		sort.SliceStable(m.PreviousManifests, func(i, j int) bool {
+			return m.PreviousManifests[i].Uri < m.PreviousManifests[j].Uri
+		})
+	}
+	return m
+}
+
+// MarshalCanonical serializes sorted manifest as canonical JSON (RFC 8785): object members are sorted,
+// there is no insignificant whitespace and strings and numbers have a single representation.
+// Manifests with the same content are byte-identical regardless of order of files. Created time is part of
+// the content, as canonical form is what gets signed, so independently created manifests are byte-identical
+// only when their creation time is the same too, e.g. with injected clock.
+func (m Model) MarshalCanonical() ([]byte, error) {
+	b, err := json.Marshal(m.Sorted())
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(b)
+}
+
+// RequiresCanonical reports whether manifest version requires canonical serialization.
+func (m Model) RequiresCanonical() bool {
+	return m.Version != "" && compareVersions(m.Version, CanonicalVersion) >= 0
+}
+
+// CheckCanonical returns ErrNotCanonical when b is not canonical serialization of JSON manifest,
+// so that signed bytes can always be derived from manifest content.
+func CheckCanonical(b []byte) error {
+	var m Model
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	canonical, err := Canonicalize(b)
+	if err != nil {
+		return err
+	}
+
+	sorted := m.Sorted()
+	for i := range m.Files {
+		if m.Files[i].Uri != sorted.Files[i].Uri {
+			return fmt.Errorf("%w: files are not sorted", ErrNotCanonical)
+		}
+	}
+	for i := range m.PreviousManifests {
+		if m.PreviousManifests[i].Uri != sorted.PreviousManifests[i].Uri {
+			return fmt.Errorf("%w: previous manifests are not sorted", ErrNotCanonical)
+		}
+	}
+
+	if !bytes.Equal(b, canonical) {
+		return ErrNotCanonical
+	}
+	return nil
+}
+
+// Canonicalize returns canonical form (RFC 8785) of JSON document.
+func Canonicalize(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("unexpected data after JSON document")
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// Members are sorted by UTF-16 code units of their names.
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value %T", v)
+	}
+	return nil
+}
+
+// canonicalNumber formats number the way ECMAScript does.
+func canonicalNumber(n json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return "", err
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("number %s can not be represented", n)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	// Exponent has no leading zeros, e.g. 1e-7 and 1e+21.
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := s[:strings.IndexByte(s, 'e')], s[strings.IndexByte(s, 'e')+1:]
+	sign, digits := exp[:1], strings.TrimLeft(exp[1:], "0")
+	return mantissa + "e" + sign + digits, nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
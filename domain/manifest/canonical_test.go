@@ -0,0 +1,114 @@
+package manifest_test
+
+import (
+	"errors"
+	"gt/domain/manifest"
+	"testing"
+	"time"
+)
+
+func TestMarshalCanonical_FileOrderIgnored(t *testing.T) {
+	a := manifest.DataFile{Uri: "a.txt", HashAlgorithm: "SHA-256", Hash: "01", Size: 1, MimeType: "text/plain"}
+	b := manifest.DataFile{Uri: "b.txt", HashAlgorithm: "SHA-256", Hash: "02", Size: 2, MimeType: "text/plain"}
+
+	// Act
+	first, err := manifest.Model{Version: "1.1", Files: []manifest.DataFile{a, b}, SignatureUri: "META-INF/manifest1.json.sig"}.MarshalCanonical()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	second, err := manifest.Model{Version: "1.1", Files: []manifest.DataFile{b, a}, SignatureUri: "META-INF/manifest1.json.sig"}.MarshalCanonical()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Assert
+	expected := `{"files":[{"hash":"01","hash_algorithm":"SHA-256","mime_type":"text/plain","size":1,"uri":"a.txt"},` +
+		`{"hash":"02","hash_algorithm":"SHA-256","mime_type":"text/plain","size":2,"uri":"b.txt"}],` +
+		`"signature_uri":"META-INF/manifest1.json.sig","version":"1.1"}`
+	if string(first) != expected || string(second) != expected {
+		t.Fatalf("invalid canonical manifest! got=%s and %s, want=%s", first, second, expected)
+	}
+}
+
+func TestMarshalCanonical_CreatedTimeIncluded(t *testing.T) {
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := created.Add(time.Second)
+	model := func(created time.Time) manifest.Model {
+		return manifest.Model{Version: "1.1", Created: &created, Files: []manifest.DataFile{}, SignatureUri: "META-INF/manifest1.json.sig"}
+	}
+
+	// Act
+	first, err := model(created).MarshalCanonical()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	same, err := model(created).MarshalCanonical()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	other, err := model(later).MarshalCanonical()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Assert
+	if string(first) != string(same) {
+		t.Fatalf("expected manifests with the same creation time to be byte-identical, got %s and %s", first, same)
+	}
+	// Creation time is signed, manifests created at different times differ.
+	if string(first) == string(other) {
+		t.Fatalf("expected manifests with different creation time to differ, got %s", first)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"whitespace", "{ \"b\" : [1, 2],\n \"a\" : null }", `{"a":null,"b":[1,2]}`},
+		{"numbers", `[1.0, -0, 1e21, 1E-7, 0.000001, 123456789012, 4.50]`, `[1,0,1e+21,1e-7,0.000001,123456789012,4.5]`},
+		{"strings", `["Aé€", "<>&", "\u000f\n", "\/"]`, "[\"Aé€\",\"<>&\",\"\\u000f\\n\",\"/\"]"},
+		{"utf16 key order", "{\"\uFB33\":1,\"\U0001F600\":2,\"€\":3}", "{\"€\":3,\"\U0001F600\":2,\"\uFB33\":1}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			b, err := manifest.Canonicalize([]byte(tc.input))
+
+			// Assert
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if string(b) != tc.expected {
+				t.Fatalf("invalid canonical form! got=%s, want=%s", b, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckCanonical(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{"canonical", `{"files":[{"hash":"01","hash_algorithm":"SHA-256","uri":"a.txt"}],"signature_uri":"s","version":"1.1"}`, nil},
+		{"indented", "{\n \"files\": [],\n \"signature_uri\": \"s\",\n \"version\": \"1.1\"\n}", manifest.ErrNotCanonical},
+		{"unsorted files", `{"files":[{"hash":"01","hash_algorithm":"SHA-256","uri":"b.txt"},{"hash":"01","hash_algorithm":"SHA-256","uri":"a.txt"}],"signature_uri":"s","version":"1.1"}`, manifest.ErrNotCanonical},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			err := manifest.CheckCanonical([]byte(tc.input))
+
+			// Assert
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected error '%v' but received '%v'", tc.expected, err)
+			}
+		})
+	}
+}
@@ -1,9 +1,32 @@
 package manifest
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is schema version of manifests created by this package, in "major.minor" form.
+// Readers accept manifests of any minor version. Since version 1.1 JSON manifests are serialized canonically.
+const Version = "1.1"
+
+var ErrUnsupportedVersion = errors.New("unsupported manifest version")
+
 // Model defines Manifest structure
 type Model struct {
-	Files        []DataFile `json:"files"`
-	SignatureUri string     `json:"signature_uri"`
+	// Version is schema version of the manifest. Manifests without version predate versioning.
+	Version string `json:"version,omitempty"`
+	// Created is time when manifest was created.
+	Created *time.Time `json:"created,omitempty"`
+	// Tool identifies software which created the manifest.
+	Tool string `json:"tool,omitempty"`
+	// Signer holds optional claims of the signer, they are not verified.
+	Signer            *SignerClaims       `json:"signer,omitempty"`
+	Files             []DataFile          `json:"files"`
+	SignatureUri      string              `json:"signature_uri"`
+	PreviousManifests []ManifestReference `json:"previous_manifests,omitempty"`
 }
 
 // DataFile points to associated file in container
@@ -11,4 +34,84 @@ type DataFile struct {
 	Uri           string `json:"uri"`
 	HashAlgorithm string `json:"hash_algorithm"`
 	Hash          string `json:"hash"`
+	Size          int64  `json:"size,omitempty"`
+	MimeType      string `json:"mime_type,omitempty"`
+}
+
+// SignerClaims are free-form statements of the signer
+type SignerClaims struct {
+	Name   string `json:"name,omitempty" xml:"Name,omitempty"`
+	Role   string `json:"role,omitempty" xml:"Role,omitempty"`
+	Reason string `json:"reason,omitempty" xml:"Reason,omitempty"`
+}
+
+// ManifestReference points to manifest which existed in container when manifest was created
+type ManifestReference struct {
+	Uri           string `json:"uri" xml:"URI,attr"`
+	HashAlgorithm string `json:"hash_algorithm" xml:"HashAlgorithm,attr"`
+	Hash          string `json:"hash" xml:"Hash,attr"`
+}
+
+// CheckVersion returns ErrUnsupportedVersion when major version of the manifest is newer than Version.
+func (m Model) CheckVersion() error {
+	if m.Version == "" {
+		return nil
+	}
+
+	major, _, err := parseVersion(m.Version)
+	if err != nil {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedVersion, m.Version)
+	}
+
+	supported, _, _ := parseVersion(Version)
+	if major > supported {
+		return fmt.Errorf("%w: %s, newest supported version is %s", ErrUnsupportedVersion, m.Version, Version)
+	}
+	return nil
+}
+
+// parseVersion parses "major.minor" version, minor version is optional.
+func parseVersion(version string) (major, minor int, err error) {
+	parts := strings.SplitN(version, ".", 2)
+	if major, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if len(parts) > 1 {
+		if minor, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if major < 0 || minor < 0 {
+		return 0, 0, fmt.Errorf("negative version %s", version)
+	}
+	return major, minor, nil
+}
+
+// compareVersions returns -1, 0 or 1 when version a is older, the same or newer than b.
+// Invalid versions are older than any valid version.
+func compareVersions(a, b string) int {
+	aMajor, aMinor, aErr := parseVersion(a)
+	bMajor, bMinor, bErr := parseVersion(b)
+	switch {
+	case aErr != nil || bErr != nil:
+		if aErr != nil && bErr != nil {
+			return 0
+		}
+		if aErr != nil {
+			return -1
+		}
+		return 1
+	case aMajor != bMajor:
+		if aMajor < bMajor {
+			return -1
+		}
+		return 1
+	case aMinor != bMinor:
+		if aMinor < bMinor {
+			return -1
+		}
+		return 1
+	}
+	return 0
 }
@@ -1,5 +1,16 @@
 module gt
 
-go 1.16
+go 1.17
 
-require github.com/guardtime/goksi v1.0.0 // indirect
+require (
+	github.com/guardtime/goksi v1.0.0
+	github.com/spf13/cobra v1.8.1
+	golang.org/x/crypto v0.11.0
+)
+
+require (
+	github.com/fullsailor/pkcs7 v0.0.0-20190404230743-d7302db945fa // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+)
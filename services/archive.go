@@ -1,10 +1,44 @@
 package services
 
+import (
+	"io"
+	"time"
+)
+
+// ArchiveEntry is a single file inside archive.
+type ArchiveEntry struct {
+	// Name is slash separated path of the file inside archive.
+	Name     string
+	Modified time.Time
+	// Uncompressed entries are stored in archive without compression.
+	Uncompressed bool
+	// Size and CRC32 are uncompressed size and checksum of entry read from archive, zero for other entries.
+	Size  int64
+	CRC32 uint32
+	// Open opens file content for reading. It can be called more than once.
+	Open func() (io.ReadCloser, error)
+}
+
 type ArchiveService interface {
-	//
-	CreateArchive(filePaths []string, destinationPath string) error
+	// CreateArchive writes archive which contains given entries.
+	CreateArchive(entries []ArchiveEntry, w io.Writer) error
+
+	// ReadArchive lists archive entries without extracting them.
+	// Entries can be opened as long as r stays readable.
+	ReadArchive(r io.ReaderAt, size int64) ([]ArchiveEntry, error)
+
+	// ReadArchiveWithDuplicates lists archive entries like ReadArchive, but accepts entries with the same name,
+	// so that containers damaged by older versions can be repaired. Entries are listed in archive order.
+	ReadArchiveWithDuplicates(r io.ReaderAt, size int64) ([]ArchiveEntry, error)
+
+	// AppendArchive writes archive which contains every entry of archive read from r followed by given entries.
+	// Existing entries are copied as they are, without decompressing them.
+	AppendArchive(r io.ReaderAt, size int64, entries []ArchiveEntry, w io.Writer) error
+
+	// ReplaceArchive writes archive read from r with its entries replaced by given entries of the same name.
+	// Entries keep their order, other entries are copied as they are, without decompressing them.
+	ReplaceArchive(r io.ReaderAt, size int64, entries []ArchiveEntry, w io.Writer) error
 
-	// Extract extracts archive files into temp location.
-	// Cleanup should be handled by caller
-	Extract(archivePath string) ([]string, error)
+	// Extract extracts archive files into outDir and returns their paths.
+	Extract(archivePath, outDir string) ([]string, error)
 }
@@ -2,111 +2,381 @@ package container
 
 import (
 	"archive/zip"
+	"bytes"
+	"errors"
 	"fmt"
+	"gt/services"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
-type ZipArchiveService struct{}
+var (
+	ErrInvalidEntryName = errors.New("invalid entry name")
+	ErrSymlinkEntry     = errors.New("symbolic links are not allowed")
+	ErrDuplicateEntry   = errors.New("duplicate entry")
+	ErrTooManyEntries   = errors.New("too many entries")
+	ErrEntryTooLarge    = errors.New("entry is too large")
+	ErrArchiveTooLarge  = errors.New("archive is too large")
+	ErrCompressionRatio = errors.New("compression ratio is too high")
+)
+
+// ArchiveEntryError describes why archive entry was rejected.
+type ArchiveEntryError struct {
+	Name string
+	Err  error
+}
+
+func (e *ArchiveEntryError) Error() string {
+	return fmt.Sprintf("entry '%s': %s", e.Name, e.Err)
+}
+
+func (e *ArchiveEntryError) Unwrap() error {
+	return e.Err
+}
+
+// ArchiveLimits restricts archives accepted by ZipArchiveService. Zero value disables a limit.
+// Sizes are uncompressed sizes in bytes.
+type ArchiveLimits struct {
+	MaxEntries   int
+	MaxTotalSize int64
+	MaxEntrySize int64
+	// MaxCompressionRatio is checked only for entries larger than 1 MiB.
+	MaxCompressionRatio int64
+}
+
+// DefaultArchiveLimits returns limits used by NewZipArchiveService.
+func DefaultArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxEntries:          10000,
+		MaxTotalSize:        4 << 30,
+		MaxEntrySize:        2 << 30,
+		MaxCompressionRatio: 100,
+	}
+}
+
+// compressionRatioThreshold is size of entry from which compression ratio is checked.
+const compressionRatioThreshold = 1 << 20
+
+type ZipArchiveService struct {
+	limits  ArchiveLimits
+	workDir string
+}
 
-func NewZipArchiveService() ZipArchiveService {
-	return ZipArchiveService{}
+// ZipArchiveOption configures ZipArchiveService.
+type ZipArchiveOption func(*ZipArchiveService)
+
+// ZipArchiveOptLimits replaces default archive limits.
+func ZipArchiveOptLimits(limits ArchiveLimits) ZipArchiveOption {
+	return func(zas *ZipArchiveService) {
+		zas.limits = limits
+	}
+}
+
+// ZipArchiveOptWorkDir sets root directory of extraction workspaces. Default is directory for temporary files.
+func ZipArchiveOptWorkDir(root string) ZipArchiveOption {
+	return func(zas *ZipArchiveService) {
+		zas.workDir = root
+	}
+}
+
+func NewZipArchiveService(opts ...ZipArchiveOption) ZipArchiveService {
+	zas := ZipArchiveService{
+		limits: DefaultArchiveLimits(),
+	}
+
+	for _, opt := range opts {
+		opt(&zas)
+	}
+	return zas
 }
 
 // CreateArchive has implementation to create zip archives.
-func (zas ZipArchiveService) CreateArchive(filePaths []string, destinationPath string) error {
-	zipFile, err := os.Create(destinationPath)
+func (zas ZipArchiveService) CreateArchive(entries []services.ArchiveEntry, w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		if err := zas.addEntryToZip(zipWriter, entry); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// ReadArchive lists zip archive entries. Directory entries are skipped.
+// Archive is rejected when any of its entries is unsafe or exceeds limits.
+func (zas ZipArchiveService) ReadArchive(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+	return zas.readArchive(r, size, false)
+}
+
+// ReadArchiveWithDuplicates is ReadArchive which accepts entries with the same name, every other check still applies.
+func (zas ZipArchiveService) ReadArchiveWithDuplicates(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+	return zas.readArchive(r, size, true)
+}
+
+func (zas ZipArchiveService) readArchive(r io.ReaderAt, size int64, allowDuplicates bool) ([]services.ArchiveEntry, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := zas.checkEntries(zipReader.File, allowDuplicates); err != nil {
+		return nil, err
+	}
+
+	entries := make([]services.ArchiveEntry, 0, len(zipReader.File))
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		f := f
+		entries = append(entries, services.ArchiveEntry{
+			Name:         f.Name,
+			Modified:     f.Modified,
+			Uncompressed: f.Method == zip.Store,
+			Size:         int64(f.UncompressedSize64),
+			CRC32:        f.CRC32,
+			Open: func() (io.ReadCloser, error) {
+				return f.Open()
+			},
+		})
+	}
+	return entries, nil
+}
+
+// AppendArchive copies zip archive read from r into w and appends given entries to it.
+// Existing entries are copied raw, so their content is neither decompressed nor compressed again.
+// Archive is rejected when any of its entries is unsafe or exceeds limits.
+func (zas ZipArchiveService) AppendArchive(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+	zipReader, err := zip.NewReader(r, size)
 	if err != nil {
 		return err
 	}
-	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	if err := zas.checkEntries(zipReader.File, false); err != nil {
+		return err
+	}
 
-	for _, filePath := range filePaths {
-		if err := zas.addFileToZip(zipWriter, filePath); err != nil {
+	zipWriter := zip.NewWriter(w)
+	for _, f := range zipReader.File {
+		if err := zipWriter.Copy(f); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	for _, entry := range entries {
+		if err := zas.addEntryToZip(zipWriter, entry); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
 }
 
-// Extract extracts archive. It saves extracted files into tmp directory.
-// tmp directory has to be cleaned up by API caller after work is done.
-func (zas ZipArchiveService) Extract(archivePath string) ([]string, error) {
+// ReplaceArchive copies zip archive read from r into w with entries of the same name as given entries replaced.
+// Other entries are copied raw, so their content is neither decompressed nor compressed again.
+// Archive is rejected when any of its entries is unsafe or exceeds limits, or does not have given entry.
+func (zas ZipArchiveService) ReplaceArchive(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	if err := zas.checkEntries(zipReader.File, false); err != nil {
+		return err
+	}
+
+	replacements := make(map[string]services.ArchiveEntry, len(entries))
+	for _, entry := range entries {
+		replacements[entry.Name] = entry
+	}
+
+	zipWriter := zip.NewWriter(w)
+	for _, f := range zipReader.File {
+		entry, ok := replacements[f.Name]
+		if !ok {
+			if err := zipWriter.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := zas.addEntryToZip(zipWriter, entry); err != nil {
+			return err
+		}
+		delete(replacements, f.Name)
+	}
+
+	for name := range replacements {
+		return fmt.Errorf("%w: entry '%s' to replace not found", os.ErrNotExist, name)
+	}
+	return zipWriter.Close()
+}
+
+// Extract extracts archive into outDir, which must not exist or be empty. It returns paths of extracted files.
+// Files are extracted into workspace of the operation first, so outDir is not created when extraction fails.
+// Archive is rejected before anything is written when any of its entries is unsafe or exceeds limits.
+func (zas ZipArchiveService) Extract(archivePath, outDir string) ([]string, error) {
+	if err := checkOutputDir(outDir); err != nil {
+		return nil, err
+	}
+
 	r, err := zip.OpenReader(archivePath)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
 
+	if err := zas.checkEntries(r.File, false); err != nil {
+		return nil, err
+	}
+
+	dir, cleanup, err := newWorkspace(zas.workDir, "open")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	extractDir := filepath.Join(dir, "files")
+	if err := os.Mkdir(extractDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
 	var fileNames []string
 	for _, f := range r.File {
-		fpath := filepath.Join(tmpFolderPath, f.Name)
+		fpath := filepath.Join(extractDir, filepath.FromSlash(f.Name))
 
 		if f.FileInfo().IsDir() {
 			// Make Folder
-			os.MkdirAll(fpath, os.ModePerm)
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		fileNames = append(fileNames, fpath)
+		fileNames = append(fileNames, filepath.Join(outDir, filepath.FromSlash(f.Name)))
 
 		// Make File
 		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
 			return nil, err
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return nil, err
-		}
-
 		rc, err := f.Open()
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = io.Copy(outFile, rc)
+		// Reader of zip entry fails when content exceeds size declared in archive, declared sizes are checked above.
+		err = writeFile(fpath, func(w io.Writer) error {
+			_, err := io.Copy(w, rc)
+			return err
+		})
 
-		// Close the file without defer to close before next iteration of loop
-		outFile.Close()
+		// Close without defer to close before next iteration of loop
 		rc.Close()
 
 		if err != nil {
 			return nil, err
 		}
 	}
+
+	if err := moveDir(extractDir, outDir); err != nil {
+		return nil, err
+	}
 	return fileNames, nil
 }
 
-func (zas ZipArchiveService) addFileToZip(zipWriter *zip.Writer, filePath string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
+// checkEntries rejects unsafe entries and archives exceeding limits. Duplicate entries are rejected unless allowed.
+func (zas ZipArchiveService) checkEntries(files []*zip.File, allowDuplicates bool) error {
+	if zas.limits.MaxEntries > 0 && len(files) > zas.limits.MaxEntries {
+		return fmt.Errorf("%w: archive has %v entries, limit is %v", ErrTooManyEntries, len(files), zas.limits.MaxEntries)
 	}
-	defer file.Close()
 
-	info, err := file.Stat()
-	if err != nil {
-		return err
+	names := make(map[string]bool, len(files))
+	var total uint64
+	for _, f := range files {
+		if err := zas.checkEntry(f); err != nil {
+			return &ArchiveEntryError{Name: f.Name, Err: err}
+		}
+
+		name := strings.TrimSuffix(f.Name, "/")
+		if names[name] && !allowDuplicates {
+			return &ArchiveEntryError{Name: f.Name, Err: ErrDuplicateEntry}
+		}
+		names[name] = true
+
+		total += f.UncompressedSize64
+		if zas.limits.MaxTotalSize > 0 && total > uint64(zas.limits.MaxTotalSize) {
+			return fmt.Errorf("%w: uncompressed size exceeds %v bytes", ErrArchiveTooLarge, zas.limits.MaxTotalSize)
+		}
 	}
+	return nil
+}
+
+func (zas ZipArchiveService) checkEntry(f *zip.File) error {
+	if !isSafeEntryName(f.Name) {
+		return ErrInvalidEntryName
+	}
+
+	if f.Mode()&os.ModeSymlink != 0 {
+		return ErrSymlinkEntry
+	}
+
+	if zas.limits.MaxEntrySize > 0 && f.UncompressedSize64 > uint64(zas.limits.MaxEntrySize) {
+		return fmt.Errorf("%w: %v bytes, limit is %v", ErrEntryTooLarge, f.UncompressedSize64, zas.limits.MaxEntrySize)
+	}
+
+	if zas.limits.MaxCompressionRatio > 0 && f.UncompressedSize64 > compressionRatioThreshold {
+		compressed := f.CompressedSize64
+		if compressed == 0 {
+			compressed = 1
+		}
 
-	header, err := zip.FileInfoHeader(info)
+		if f.UncompressedSize64/compressed > uint64(zas.limits.MaxCompressionRatio) {
+			return fmt.Errorf("%w: %v bytes compressed to %v", ErrCompressionRatio, f.UncompressedSize64, f.CompressedSize64)
+		}
+	}
+	return nil
+}
+
+// isSafeEntryName reports whether entry name is a relative slash separated path which stays inside archive root.
+func isSafeEntryName(name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	if name == "" || name == "." || strings.Contains(name, "\\") || path.IsAbs(name) {
+		return false
+	}
+
+	// Drive letters are absolute paths on Windows.
+	if len(name) >= 2 && name[1] == ':' {
+		return false
+	}
+
+	return path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+func (zas ZipArchiveService) addEntryToZip(zipWriter *zip.Writer, entry services.ArchiveEntry) error {
+	file, err := entry.Open()
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	// preserve folder structure
-	if strings.Contains(filePath, "manifest") {
-		header.Name = fmt.Sprintf("%s%s", metaInfPathZip, filepath.Base(filePath))
+	if entry.Uncompressed {
+		return addStoredEntryToZip(zipWriter, entry, file)
 	}
 
-	header.Method = zip.Deflate
+	header := &zip.FileHeader{
+		Name:     entry.Name,
+		Modified: entry.Modified,
+		Method:   zip.Deflate,
+	}
+	header.SetMode(0644)
 
 	writer, err := zipWriter.CreateHeader(header)
 	if err != nil {
@@ -116,3 +386,61 @@ func (zas ZipArchiveService) addFileToZip(zipWriter *zip.Writer, filePath string
 	_, err = io.Copy(writer, file)
 	return err
 }
+
+// addStoredEntryToZip writes entry without compression and with sizes and checksum in its local header,
+// as ASiC requires for mimetype. Checksum and size of entries read from archive are reused, so that their
+// content is streamed, content of other entries is read into memory to compute them.
+func addStoredEntryToZip(zipWriter *zip.Writer, entry services.ArchiveEntry, content io.Reader) error {
+	crc, size := entry.CRC32, entry.Size
+	if size == 0 {
+		b, err := ioutil.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		crc, size = crc32.ChecksumIEEE(b), int64(len(b))
+		content = bytes.NewReader(b)
+	}
+
+	header := &zip.FileHeader{
+		Name:               entry.Name,
+		Method:             zip.Store,
+		CRC32:              crc,
+		CompressedSize64:   uint64(size),
+		UncompressedSize64: uint64(size),
+	}
+	header.SetMode(0644)
+	// CreateRaw does not set MS-DOS time and UTF-8 flag from header, unlike CreateHeader.
+	if !entry.Modified.IsZero() {
+		header.SetModTime(entry.Modified)
+	}
+	if !isASCII(entry.Name) {
+		header.Flags |= zipFlagUTF8
+	}
+
+	writer, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+
+	// Content is checked against size, zip readers check checksum.
+	n, err := io.Copy(writer, io.LimitReader(content, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("entry '%s': expected %v bytes, got %v", entry.Name, size, n)
+	}
+	return nil
+}
+
+// zipFlagUTF8 marks entry name as UTF-8.
+const zipFlagUTF8 = 0x800
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,345 @@
+package container_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"gt/services"
+	"gt/services/container"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testZipEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+func TestReadArchive_UnsafeEntriesRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []testZipEntry
+		limits      container.ArchiveLimits
+		expectedErr error
+	}{
+		{
+			name:        "parent directory",
+			entries:     []testZipEntry{{name: "../evil.txt"}},
+			expectedErr: container.ErrInvalidEntryName,
+		},
+		{
+			name:        "nested parent directory",
+			entries:     []testZipEntry{{name: "a/../../evil.txt"}},
+			expectedErr: container.ErrInvalidEntryName,
+		},
+		{
+			name:        "absolute path",
+			entries:     []testZipEntry{{name: "/etc/evil.txt"}},
+			expectedErr: container.ErrInvalidEntryName,
+		},
+		{
+			name:        "windows path",
+			entries:     []testZipEntry{{name: "C:\\evil.txt"}},
+			expectedErr: container.ErrInvalidEntryName,
+		},
+		{
+			name:        "symbolic link",
+			entries:     []testZipEntry{{name: "link", content: "/etc/passwd", mode: os.ModeSymlink | 0777}},
+			expectedErr: container.ErrSymlinkEntry,
+		},
+		{
+			name:        "duplicate entry",
+			entries:     []testZipEntry{{name: "text1.txt"}, {name: "text1.txt"}},
+			expectedErr: container.ErrDuplicateEntry,
+		},
+		{
+			name:        "too many entries",
+			entries:     []testZipEntry{{name: "text1.txt"}, {name: "text2.txt"}},
+			limits:      container.ArchiveLimits{MaxEntries: 1},
+			expectedErr: container.ErrTooManyEntries,
+		},
+		{
+			name:        "entry too large",
+			entries:     []testZipEntry{{name: "text1.txt", content: "content"}},
+			limits:      container.ArchiveLimits{MaxEntrySize: 6},
+			expectedErr: container.ErrEntryTooLarge,
+		},
+		{
+			name:        "archive too large",
+			entries:     []testZipEntry{{name: "text1.txt", content: "content"}, {name: "text2.txt", content: "content"}},
+			limits:      container.ArchiveLimits{MaxTotalSize: 10},
+			expectedErr: container.ErrArchiveTooLarge,
+		},
+		{
+			name:        "compression ratio",
+			entries:     []testZipEntry{{name: "zeros.bin", content: strings.Repeat("0", 2<<20)}},
+			limits:      container.ArchiveLimits{MaxCompressionRatio: 100},
+			expectedErr: container.ErrCompressionRatio,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := testZip(t, tt.entries...)
+			zas := container.NewZipArchiveService(container.ZipArchiveOptLimits(tt.limits))
+
+			// Act
+			_, err := zas.ReadArchive(bytes.NewReader(archive), int64(len(archive)))
+
+			// Assert
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error '%s' but received '%v'", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestReadArchive_EntryErrorNamesEntry(t *testing.T) {
+	archive := testZip(t, testZipEntry{name: "../evil.txt"})
+	zas := container.NewZipArchiveService()
+
+	// Act
+	_, err := zas.ReadArchive(bytes.NewReader(archive), int64(len(archive)))
+
+	// Assert
+	var entryErr *container.ArchiveEntryError
+	if !errors.As(err, &entryErr) || entryErr.Name != "../evil.txt" {
+		t.Fatalf("expected entry error for '../evil.txt' but received '%v'", err)
+	}
+}
+
+func TestAppendArchive_EntriesCopiedRaw(t *testing.T) {
+	archive := testZip(t, testZipEntry{name: "text1.txt", content: strings.Repeat("content", 100)})
+	zas := container.NewZipArchiveService()
+
+	// Act
+	var buf bytes.Buffer
+	err := zas.AppendArchive(bytes.NewReader(archive), int64(len(archive)), testEntries("META-INF/manifest1.json"), &buf)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	original, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal("failed to read original archive:", err)
+	}
+	appended, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("failed to read appended archive:", err)
+	}
+
+	if len(appended.File) != 2 || appended.File[0].Name != "text1.txt" || appended.File[1].Name != "META-INF/manifest1.json" {
+		t.Fatalf("invalid entries of appended archive: %v", appended.File)
+	}
+
+	if rawContent(t, appended.File[0]) != rawContent(t, original.File[0]) {
+		t.Error("expected existing entry to be copied without recompression")
+	}
+}
+
+func TestReplaceArchive_MissingEntryRejected(t *testing.T) {
+	archive := testZip(t, testZipEntry{name: "text1.txt", content: "content"})
+	zas := container.NewZipArchiveService()
+
+	// Act
+	err := zas.ReplaceArchive(bytes.NewReader(archive), int64(len(archive)), testEntries("text2.txt"), ioutil.Discard)
+
+	// Assert
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error of missing entry, got %v", err)
+	}
+}
+
+func TestCreateArchive_StoredEntriesWithoutDataDescriptor(t *testing.T) {
+	var stored bytes.Buffer
+	w := zip.NewWriter(&stored)
+	fw, err := w.CreateHeader(&zip.FileHeader{Name: "stored.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte("stored content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zas := container.NewZipArchiveService()
+	entries, err := zas.ReadArchive(bytes.NewReader(stored.Bytes()), int64(stored.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mimetype := testEntry("mimetype", "application/vnd.etsi.asic-e+zip")
+	mimetype.Uncompressed = true
+
+	// Act
+	var buf bytes.Buffer
+	err = zas.CreateArchive(append([]services.ArchiveEntry{mimetype}, entries...), &buf)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("failed to read archive:", err)
+	}
+	expected := map[string]string{"mimetype": "application/vnd.etsi.asic-e+zip", "stored.txt": "stored content"}
+	for _, f := range r.File {
+		if f.Method != zip.Store || f.Flags&0x8 != 0 {
+			t.Errorf("expected '%s' to be stored with sizes in local header, got method %v and flags %#x", f.Name, f.Method, f.Flags)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(content) != expected[f.Name] {
+			t.Errorf("invalid content of '%s': %s, %v", f.Name, content, err)
+		}
+	}
+}
+
+// rawContent returns compressed content of zip entry.
+func rawContent(t *testing.T, f *zip.File) string {
+	t.Helper()
+
+	r, err := f.OpenRaw()
+	if err != nil {
+		t.Fatal("failed to open raw entry:", err)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("failed to read raw entry:", err)
+	}
+	return string(content)
+}
+
+func TestExtract_UnsafeArchiveNotExtracted(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "unsafe.zip")
+	archive := testZip(t, testZipEntry{name: "text1.txt", content: "content"}, testZipEntry{name: "../evil.txt"})
+	if err := ioutil.WriteFile(archivePath, archive, 0644); err != nil {
+		t.Fatal("failed to setup test:", err)
+	}
+
+	outDir := filepath.Join(dir, "out")
+	zas := container.NewZipArchiveService()
+
+	// Act
+	_, err := zas.Extract(archivePath, outDir)
+
+	// Assert
+	if !errors.Is(err, container.ErrInvalidEntryName) {
+		t.Fatalf("expected error '%s' but received '%v'", container.ErrInvalidEntryName, err)
+	}
+
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be extracted")
+	}
+}
+
+func TestExtract_ExtractedIntoOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "container.zip")
+	archive := testZip(t, testZipEntry{name: "docs/text1.txt", content: "content"})
+	if err := ioutil.WriteFile(archivePath, archive, 0644); err != nil {
+		t.Fatal("failed to setup test:", err)
+	}
+
+	workDir := filepath.Join(dir, "work")
+	outDir := filepath.Join(dir, "out")
+	zas := container.NewZipArchiveService(container.ZipArchiveOptWorkDir(workDir))
+
+	// Act
+	paths, err := zas.Extract(archivePath, outDir)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expectedPath := filepath.Join(outDir, "docs", "text1.txt")
+	if len(paths) != 1 || paths[0] != expectedPath {
+		t.Fatalf("invalid extracted paths! got=%v, want=%v", paths, []string{expectedPath})
+	}
+
+	content, err := ioutil.ReadFile(expectedPath)
+	if err != nil || string(content) != "content" {
+		t.Fatalf("invalid extracted file content '%s': %v", content, err)
+	}
+
+	assertEmptyDir(t, workDir)
+}
+
+func TestExtract_OutputDirNotEmpty(t *testing.T) {
+	dir := t.TempDir()
+	outDir := filepath.Join(dir, "out")
+	dataFile := filepath.Join(outDir, "text1.txt")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatal("failed to setup test:", err)
+	}
+	if err := ioutil.WriteFile(dataFile, []byte("original"), 0644); err != nil {
+		t.Fatal("failed to setup test:", err)
+	}
+
+	zas := container.NewZipArchiveService()
+
+	// Act
+	_, err := zas.Extract(filepath.Join(dir, "container.zip"), outDir)
+
+	// Assert
+	expectedErrStr := "output directory '" + outDir + "' is not empty"
+	if err == nil || err.Error() != expectedErrStr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErrStr, err)
+	}
+}
+
+// assertEmptyDir fails the test when dir contains anything, leftover workspaces in particular.
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal("failed to read directory:", err)
+	}
+
+	if len(files) != 0 {
+		t.Fatalf("expected directory '%s' to be empty but it has %v entries", dir, len(files))
+	}
+}
+
+// testZip builds zip archive without any checks so that unsafe archives can be created.
+func testZip(t *testing.T, entries ...testZipEntry) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode == 0 {
+			e.mode = 0644
+		}
+		header.SetMode(e.mode)
+
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal("failed to setup test:", err)
+		}
+
+		if _, err := fw.Write([]byte(e.content)); err != nil {
+			t.Fatal("failed to setup test:", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal("failed to setup test:", err)
+	}
+	return buf.Bytes()
+}
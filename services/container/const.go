@@ -1,12 +1,18 @@
 package container
 
 const (
-	tmpFolderPath                = "./tmp/"
-	fullMetaInfPath              = "./tmp/META-INF/"
-	metaInfPathZip               = "META-INF/"
-	initialManifestName          = "manifest1.json"
-	manifestFileNamePattern      = "manifest%v.json"
-	signatureFileFullPathPattern = "%s%s.sig"
-	signatureFileNamePattern     = "%s.sig"
-	signatureFileExtension       = ".sig"
+	metaInfPathZip           = "META-INF/"
+	initialSignatureID       = 1
+	initialManifestName      = "manifest1.json"
+	manifestFileNamePattern  = "manifest%v.json"
+	signatureFileNamePattern = "%s.sig"
+	signatureFileExtension   = ".sig"
+	backupExtension          = ".bak"
+	defaultTool              = "gt"
+	defaultMimeType          = "application/octet-stream"
+
+	asicMimetypeName         = "mimetype"
+	asicMimetype             = "application/vnd.etsi.asic-e+zip"
+	asicManifestNamePattern  = "ASiCManifest%v.xml"
+	asicTimestampNamePattern = "timestamp%v.tst"
 )
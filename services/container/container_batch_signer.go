@@ -0,0 +1,133 @@
+package container
+
+import (
+	"context"
+	"gt/services"
+	"io"
+)
+
+// BatchResult is result of adding signature to single container of a batch.
+type BatchResult struct {
+	ContainerPath string
+	// SignatureID is id of added signature, it is set when Err is nil.
+	SignatureID int
+	Err         error
+}
+
+// batchItem is container whose manifest waits for signing.
+type batchItem struct {
+	result   int
+	id       int
+	entries  map[string]entryState
+	response SignatureCreatorResponse
+}
+
+// entryState identifies content of archive entry without reading it.
+type entryState struct {
+	size  int64
+	crc32 uint32
+}
+
+// AddSignatureBatch adds new signature to every container like AddSignature, but manifests of all containers
+// are signed with single KSI request. Containers which can not be read or hashed are reported in their results
+// and the rest are signed anyway. When KSI request fails, error is returned and no container is changed.
+// When ctx is done, containers which are not written yet are left untouched and ctx error is returned.
+func (s Signer) AddSignatureBatch(ctx context.Context, containerPaths []string, files ...string) ([]BatchResult, error) {
+	results := make([]BatchResult, len(containerPaths))
+	var items []batchItem
+	for i, containerPath := range containerPaths {
+		results[i].ContainerPath = containerPath
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		item, err := s.batchItem(ctx, containerPath, files)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			results[i].Err = err
+			continue
+		}
+		item.result = i
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return results, nil
+	}
+
+	responses := make([]SignatureCreatorResponse, len(items))
+	for i, item := range items {
+		responses[i] = item.response
+	}
+	if err := s.sigCreator.SignManifests(ctx, responses, s.manifestHashAlgorithm); err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		resp := responses[i]
+		result := &results[item.result]
+		result.Err = rewriteContainer(result.ContainerPath, s.backup, func(r io.ReaderAt, size int64, w io.Writer) error {
+			entries, err := s.archiveService.ReadArchive(r, size)
+			if err != nil {
+				return err
+			}
+			if !sameEntries(entryStates(entries), item.entries) {
+				return ErrContainerChanged
+			}
+			return s.archiveService.AppendArchive(r, size, resp.archiveEntries(), w)
+		})
+		if result.Err == nil {
+			result.SignatureID = item.id
+		}
+	}
+	return results, nil
+}
+
+// batchItem reads container and creates manifest of its new signature.
+func (s Signer) batchItem(ctx context.Context, containerPath string, files []string) (batchItem, error) {
+	var item batchItem
+	err := readContainer(containerPath, func(r io.ReaderAt, size int64) error {
+		entries, err := s.archiveService.ReadArchive(r, size)
+		if err != nil {
+			return err
+		}
+
+		dataEntries, params, err := s.signatureRequest(entries, files)
+		if err != nil {
+			return err
+		}
+
+		item.id = params.ID
+		item.entries = entryStates(entries)
+		item.response, err = s.sigCreator.NewManifest(ctx, dataEntries, params)
+		return err
+	})
+	return item, err
+}
+
+func entryStates(entries []services.ArchiveEntry) map[string]entryState {
+	states := make(map[string]entryState, len(entries))
+	for _, e := range entries {
+		states[e.Name] = entryState{size: e.Size, crc32: e.CRC32}
+	}
+	return states
+}
+
+// sameEntries reports whether archive has the same entries with the same size and checksum,
+// so that data files replaced while manifest was signed are noticed.
+func sameEntries(a, b map[string]entryState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, state := range a {
+		if other, ok := b[name]; !ok || other != state {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package container_test
+
+import (
+	"context"
+	"errors"
+	"gt/services"
+	"gt/services/container"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guardtime/goksi/hash"
+)
+
+func batchSetup(t *testing.T, names ...string) []string {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte("original"), 0644); err != nil {
+			t.Fatal("failed to setup test:", err)
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func batchArchiveService() services.ArchiveServiceMock {
+	return services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
+		},
+		AppendArchiveFunc: func(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+			_, err := w.Write([]byte("signed"))
+			return err
+		},
+	}
+}
+
+func TestAddSignatureBatch_ManifestsSignedWithSingleRequest(t *testing.T) {
+	paths := batchSetup(t, "a.zip", "b.zip")
+	missing := filepath.Join(filepath.Dir(paths[0]), "missing.zip")
+
+	var signCalls, signed int
+	sigCreator := container.SignatureCreatorMock{
+		NewManifestFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			return container.SignatureCreatorResponse{
+				ManifestUri:  "META-INF/manifest2.json",
+				SignatureUri: "META-INF/manifest2.json.sig",
+			}, nil
+		},
+		SignManifestsFunc: func(ctx context.Context, responses []container.SignatureCreatorResponse, alg hash.Algorithm) error {
+			signCalls++
+			signed = len(responses)
+			return nil
+		},
+	}
+
+	signer := container.NewSigner(sigCreator, batchArchiveService())
+
+	// Act
+	results, err := signer.AddSignatureBatch(context.Background(), []string{paths[0], missing, paths[1]})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signCalls != 1 || signed != 2 {
+		t.Fatalf("expected 2 manifests signed with single request, got %v requests for %v manifests", signCalls, signed)
+	}
+	if results[1].Err == nil {
+		t.Fatal("expected missing container to fail")
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil || results[i].SignatureID != 2 {
+			t.Fatalf("expected signature 2 added to %s, got %+v", results[i].ContainerPath, results[i])
+		}
+		if content, _ := ioutil.ReadFile(results[i].ContainerPath); string(content) != "signed" {
+			t.Errorf("expected container to be rewritten but it has content '%s'", content)
+		}
+	}
+}
+
+func TestAddSignatureBatch_SigningFails(t *testing.T) {
+	paths := batchSetup(t, "a.zip", "b.zip")
+
+	expectedErr := errors.New("KSI signing failed")
+	sigCreator := container.SignatureCreatorMock{
+		NewManifestFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			return container.SignatureCreatorResponse{ManifestUri: "META-INF/manifest2.json"}, nil
+		},
+		SignManifestsFunc: func(ctx context.Context, responses []container.SignatureCreatorResponse, alg hash.Algorithm) error {
+			return expectedErr
+		},
+	}
+
+	signer := container.NewSigner(sigCreator, batchArchiveService())
+
+	// Act
+	_, err := signer.AddSignatureBatch(context.Background(), paths)
+
+	// Assert
+	if err != expectedErr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErr, err)
+	}
+	for _, p := range paths {
+		if content, _ := ioutil.ReadFile(p); string(content) != "original" {
+			t.Errorf("expected container to be untouched but it has content '%s'", content)
+		}
+	}
+	if files, _ := os.ReadDir(filepath.Dir(paths[0])); len(files) != len(paths) {
+		t.Errorf("expected no temporary files next to containers but directory has %v entries", len(files))
+	}
+}
+
+func TestAddSignatureBatch_ReplacedDataFileRejected(t *testing.T) {
+	paths := batchSetup(t, "a.zip")
+
+	var replaced bool
+	archiveService := batchArchiveService()
+	archiveService.ReadArchiveFunc = func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+		entries := testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig")
+		entries[0].Size, entries[0].CRC32 = 8, 0x1234
+		if replaced {
+			// Data file has the same name, but different content.
+			entries[0].CRC32 = 0x4321
+		}
+		return entries, nil
+	}
+	sigCreator := container.SignatureCreatorMock{
+		NewManifestFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			return container.SignatureCreatorResponse{ManifestUri: "META-INF/manifest2.json"}, nil
+		},
+		SignManifestsFunc: func(ctx context.Context, responses []container.SignatureCreatorResponse, alg hash.Algorithm) error {
+			replaced = true
+			return nil
+		},
+	}
+
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	results, err := signer.AddSignatureBatch(context.Background(), paths)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, container.ErrContainerChanged) {
+		t.Fatalf("expected ErrContainerChanged, got %v", results[0].Err)
+	}
+	if content, _ := ioutil.ReadFile(paths[0]); string(content) != "original" {
+		t.Errorf("expected container to be untouched but it has content '%s'", content)
+	}
+}
@@ -1,35 +1,102 @@
 package container
 
 import (
+	"context"
 	"gt/services"
-	"os"
+	"io"
+
+	"github.com/guardtime/goksi/hash"
 )
 
 type Creator struct {
-	sigCreator     SignatureCreator
-	archiveService services.ArchiveService
+	sigCreator            SignatureCreator
+	archiveService        services.ArchiveService
+	format                Format
+	dataFileHashAlgorithm hash.Algorithm
+	manifestHashAlgorithm hash.Algorithm
+}
+
+// CreatorOption configures Creator.
+type CreatorOption func(*Creator)
+
+// CreatorOptFormat selects format of created containers. Default is FormatJSON.
+func CreatorOptFormat(format Format) CreatorOption {
+	return func(c *Creator) {
+		c.format = format
+	}
+}
+
+// CreatorOptHashAlgorithms selects hash algorithms of data files and manifest. Default is hash.Default for both.
+func CreatorOptHashAlgorithms(dataFile, manifest hash.Algorithm) CreatorOption {
+	return func(c *Creator) {
+		c.dataFileHashAlgorithm = dataFile
+		c.manifestHashAlgorithm = manifest
+	}
 }
 
-func NewCreator(sigCreator SignatureCreator, archiveService services.ArchiveService) Creator {
-	return Creator{
-		sigCreator:     sigCreator,
-		archiveService: archiveService,
+func NewCreator(sigCreator SignatureCreator, archiveService services.ArchiveService, opts ...CreatorOption) Creator {
+	c := Creator{
+		sigCreator:            sigCreator,
+		archiveService:        archiveService,
+		format:                FormatJSON,
+		dataFileHashAlgorithm: hash.Default,
+		manifestHashAlgorithm: hash.Default,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
 	}
+	return c
 }
 
 // Create creates new container to given "containerFullPath". And signs it's content.
-// FilePaths slice contains all files that are added to container.
+// FilePaths slice contains all files and directories that are added to container.
+// Relative paths keep their directory structure inside container.
 func (c Creator) Create(filePaths []string, containerFullPath string) error {
-	os.MkdirAll(fullMetaInfPath, 0777)
+	return c.CreateContext(context.Background(), filePaths, containerFullPath)
+}
+
+// CreateContext is Create which stops when ctx is done, container file is not created then.
+func (c Creator) CreateContext(ctx context.Context, filePaths []string, containerFullPath string) error {
+	entries, err := collectDataFiles(filePaths)
+	if err != nil {
+		return err
+	}
+
+	return writeContainer(containerFullPath, false, func(w io.Writer) error {
+		return c.CreateStreamContext(ctx, entries, w)
+	})
+}
+
+// CreateStream signs given data files and writes container into w.
+// Data files can be created with NewDataFile.
+func (c Creator) CreateStream(files []services.ArchiveEntry, w io.Writer) error {
+	return c.CreateStreamContext(context.Background(), files, w)
+}
 
-	defer os.RemoveAll(tmpFolderPath)
+// CreateStreamContext is CreateStream which stops when ctx is done.
+func (c Creator) CreateStreamContext(ctx context.Context, files []services.ArchiveEntry, w io.Writer) error {
+	l := layoutOf(c.format)
+	if err := validateDataFiles(files, l); err != nil {
+		return err
+	}
 
-	sigResponse, err := c.sigCreator.NewSignature(filePaths, initialManifestName)
+	sigResponse, err := c.sigCreator.NewSignature(ctx, files, SignatureParams{
+		ID:                    initialSignatureID,
+		Format:                c.format,
+		DataFileHashAlgorithm: c.dataFileHashAlgorithm,
+		ManifestHashAlgorithm: c.manifestHashAlgorithm,
+	})
 	if err != nil {
 		return err
 	}
 
-	filePaths = append(filePaths, sigResponse.ManifestFilePath, sigResponse.SignatureFilePath)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entries := append(l.metadataEntries(), files...)
+	entries = append(entries, sigResponse.archiveEntries()...)
 
-	return c.archiveService.CreateArchive(filePaths, containerFullPath)
+	return c.archiveService.CreateArchive(entries, w)
 }
@@ -1,16 +1,31 @@
 package container_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"errors"
 	"gt/services"
 	"gt/services/container"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
 )
 
 func TestCreate_SignatureCreationFails(t *testing.T) {
+	dataFilesSetup(t, "file1.txt")
+	defer os.Remove("file1.txt")
+
 	expectedErr := errors.New("signature creation failure")
 	sigCreator := container.SignatureCreatorMock{
-		NewSignatureFunc: func(filePaths []string, manifestName string) (container.SignatureCreatorResponse, error) {
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
 			return container.SignatureCreatorResponse{}, expectedErr
 		},
 	}
@@ -29,21 +44,24 @@ func TestCreate_SignatureCreationFails(t *testing.T) {
 }
 
 func TestCreate_CreateArchiveFails(t *testing.T) {
+	dataFilesSetup(t, "file1.txt")
+	defer os.Remove("file1.txt")
+
 	sigCreator := container.SignatureCreatorMock{
-		NewSignatureFunc: func(filePaths []string, manifestName string) (container.SignatureCreatorResponse, error) {
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
 			return container.SignatureCreatorResponse{
-				ManifestFilePath:  "manifest1.json",
-				SignatureFilePath: "signature1.json.sig",
+				ManifestUri:  "META-INF/manifest1.json",
+				SignatureUri: "META-INF/manifest1.json.sig",
 			}, nil
 		},
 	}
 
 	expectedErr := errors.New("archive creation failure")
 	archiveService := services.ArchiveServiceMock{
-		CreateArchiveFunc: func(filePaths []string, destinationPath string) error {
-			if len(filePaths) != 3 {
-				t.Error(filePaths)
-				t.Errorf("invalid count of file paths! got=%v, want=%v", len(filePaths), 3)
+		CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+			if len(entries) != 3 {
+				t.Error(entries)
+				t.Errorf("invalid count of file paths! got=%v, want=%v", len(entries), 3)
 			}
 
 			return expectedErr
@@ -60,3 +78,284 @@ func TestCreate_CreateArchiveFails(t *testing.T) {
 		t.Fatalf("expected error '%s' but received '%s'", expectedErr, err)
 	}
 }
+
+func TestCreate_DirectoryStructurePreserved(t *testing.T) {
+	dataFilesSetup(t, "testdir/a/report.txt", "testdir/b/report.txt")
+	defer os.RemoveAll("testdir")
+
+	expectedNames := []string{"testdir/a/report.txt", "testdir/b/report.txt"}
+	sigCreator := container.SignatureCreatorMock{
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			if len(files) != len(expectedNames) {
+				t.Fatalf("invalid count of files! got=%v, want=%v", len(files), len(expectedNames))
+			}
+
+			for i, f := range files {
+				if f.Name != expectedNames[i] {
+					t.Errorf("invalid container path! got=%v, want=%v", f.Name, expectedNames[i])
+				}
+			}
+
+			return container.SignatureCreatorResponse{
+				ManifestUri:  "META-INF/manifest1.json",
+				SignatureUri: "META-INF/manifest1.json.sig",
+			}, nil
+		},
+	}
+
+	archiveService := services.ArchiveServiceMock{
+		CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+			if name := entries[len(entries)-1].Name; name != "META-INF/manifest1.json.sig" {
+				t.Errorf("invalid signature path! got=%v, want=%v", name, "META-INF/manifest1.json.sig")
+			}
+			return nil
+		},
+	}
+
+	creator := container.NewCreator(sigCreator, archiveService)
+
+	// Act
+	err := creator.Create([]string{"testdir"}, "container.zip")
+	defer os.Remove("container.zip")
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCreate_DuplicateContainerPath(t *testing.T) {
+	dataFilesSetup(t, "testdir/a/report.txt", "testdir/b/report.txt")
+	defer os.RemoveAll("testdir")
+
+	var sigCreator container.SignatureCreatorMock
+	var archiveService services.ArchiveServiceMock
+
+	creator := container.NewCreator(sigCreator, archiveService)
+
+	// Act
+	absPathA, _ := filepath.Abs("testdir/a/report.txt")
+	absPathB, _ := filepath.Abs("testdir/b/report.txt")
+	err := creator.Create([]string{absPathA, absPathB}, "container.zip")
+
+	// Assert
+	expectedErrStr := "files '" + absPathA + "' and '" + absPathB + "' have same container path 'report.txt'"
+	if err == nil || err.Error() != expectedErrStr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErrStr, err)
+	}
+}
+
+func TestCreateStream_InvalidContainerPath(t *testing.T) {
+	var sigCreator container.SignatureCreatorMock
+	var archiveService services.ArchiveServiceMock
+
+	creator := container.NewCreator(sigCreator, archiveService)
+
+	// Act
+	err := creator.CreateStream(testEntries("META-INF/manifest1.json"), ioutil.Discard)
+
+	// Assert
+	expectedErrStr := "invalid container path 'META-INF/manifest1.json' for file 'META-INF/manifest1.json'"
+	if err == nil || err.Error() != expectedErrStr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErrStr, err)
+	}
+}
+
+func dataFilesSetup(t *testing.T, paths ...string) {
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal("failed to setup test:", err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(p), 0777); err != nil {
+			t.Fatal("failed to setup test:", err)
+		}
+	}
+}
+
+func TestCreateStream_ASiCELayout(t *testing.T) {
+	sigCreator := container.SignatureCreatorMock{
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			if params.ID != 1 || params.Format != container.FormatASiCE {
+				t.Errorf("invalid signature id %v or format %s", params.ID, params.Format)
+			}
+
+			return container.SignatureCreatorResponse{
+				ManifestUri:  "META-INF/ASiCManifest1.xml",
+				SignatureUri: "META-INF/timestamp1.tst",
+			}, nil
+		},
+	}
+
+	creator := container.NewCreator(sigCreator, container.NewZipArchiveService(), container.CreatorOptFormat(container.FormatASiCE))
+
+	// Act
+	var buf bytes.Buffer
+	err := creator.CreateStream(testEntries("text1.txt"), &buf)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("failed to read container:", err)
+	}
+
+	expectedNames := []string{"mimetype", "text1.txt", "META-INF/ASiCManifest1.xml", "META-INF/timestamp1.tst"}
+	if len(r.File) != len(expectedNames) {
+		t.Fatalf("invalid count of entries! got=%v, want=%v", len(r.File), len(expectedNames))
+	}
+
+	for i, f := range r.File {
+		if f.Name != expectedNames[i] {
+			t.Errorf("invalid entry! got=%v, want=%v", f.Name, expectedNames[i])
+		}
+	}
+
+	if r.File[0].Method != zip.Store {
+		t.Errorf("mimetype must be stored without compression")
+	}
+	if r.File[0].Flags&0x8 != 0 {
+		t.Errorf("mimetype must have sizes in local header, not in data descriptor")
+	}
+	if r.File[0].CRC32 != crc32.ChecksumIEEE([]byte("application/vnd.etsi.asic-e+zip")) || r.File[0].UncompressedSize64 != 31 {
+		t.Errorf("invalid checksum or size of mimetype: %+v", r.File[0].FileHeader)
+	}
+}
+
+func TestNewSignature_DeprecatedHashAlgorithmRejected(t *testing.T) {
+	sigCreator := container.NewSignatureCreator(nil)
+
+	// Act
+	_, err := sigCreator.NewSignature(context.Background(), testEntries("text1.txt"), container.SignatureParams{
+		ID:                    1,
+		Format:                container.FormatJSON,
+		DataFileHashAlgorithm: hash.SHA1,
+		ManifestHashAlgorithm: hash.Default,
+	})
+
+	// Assert
+	if !errors.Is(err, container.ErrUnsupportedHashAlgo) {
+		t.Fatalf("expected error '%s' but received '%v'", container.ErrUnsupportedHashAlgo, err)
+	}
+}
+
+func TestCreate_DataFileMissing(t *testing.T) {
+	var sigCreator container.SignatureCreatorMock
+	var archiveService services.ArchiveServiceMock
+
+	creator := container.NewCreator(sigCreator, archiveService)
+
+	// Act
+	err := creator.Create([]string{"missing.txt"}, "container.zip")
+
+	// Assert
+	if !errors.Is(err, container.ErrDataFileMissing) {
+		t.Fatalf("expected error '%s' but received '%v'", container.ErrDataFileMissing, err)
+	}
+}
+
+func TestNewSignature_UnreadableDataFileNotSigned(t *testing.T) {
+	tests := []struct {
+		name     string
+		openErr  error
+		expected error
+	}{
+		{"missing", os.ErrNotExist, container.ErrDataFileMissing},
+		{"unreadable", os.ErrPermission, container.ErrHashFailed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ksiSigner := services.KSISignerMock{
+				SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+					t.Fatal("manifest of unreadable data file must not be signed")
+					return nil, nil
+				},
+			}
+
+			file := services.ArchiveEntry{
+				Name: "text1.txt",
+				Open: func() (io.ReadCloser, error) {
+					return nil, tc.openErr
+				},
+			}
+
+			sigCreator := container.NewSignatureCreator(ksiSigner)
+
+			// Act
+			_, err := sigCreator.NewSignature(context.Background(), []services.ArchiveEntry{file}, container.SignatureParams{
+				ID:                    1,
+				Format:                container.FormatJSON,
+				DataFileHashAlgorithm: hash.Default,
+				ManifestHashAlgorithm: hash.Default,
+			})
+
+			// Assert
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected error '%s' but received '%v'", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewSignature_KSISigningFails(t *testing.T) {
+	ksiErr := errors.New("aggregator unavailable")
+	ksiSigner := services.KSISignerMock{
+		SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			return nil, ksiErr
+		},
+	}
+
+	sigCreator := container.NewSignatureCreator(ksiSigner)
+
+	// Act
+	_, err := sigCreator.NewSignature(context.Background(), testEntries("text1.txt"), container.SignatureParams{
+		ID:                    1,
+		Format:                container.FormatJSON,
+		DataFileHashAlgorithm: hash.Default,
+		ManifestHashAlgorithm: hash.Default,
+	})
+
+	// Assert
+	if !errors.Is(err, container.ErrKSISign) || !errors.Is(err, ksiErr) {
+		t.Fatalf("expected error '%s' wrapping '%s' but received '%v'", container.ErrKSISign, ksiErr, err)
+	}
+}
+
+func TestCreateContext_CancelledBeforeSigning(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "text1.txt")
+	dataFilesSetup(t, dataFile)
+
+	ksiSigner := services.KSISignerMock{
+		SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			t.Fatal("manifest must not be signed after cancellation")
+			return nil, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	containerPath := filepath.Join(dir, "container.zip")
+	creator := container.NewCreator(container.NewSignatureCreator(ksiSigner), container.NewZipArchiveService())
+
+	// Act
+	err := creator.CreateContext(ctx, []string{dataFile}, containerPath)
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error '%s' but received '%v'", context.Canceled, err)
+	}
+
+	if _, err := os.Stat(containerPath); !os.IsNotExist(err) {
+		t.Errorf("expected container not to be created, got %v", err)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected no temporary files next to container but directory has %v entries", len(files))
+	}
+}
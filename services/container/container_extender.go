@@ -0,0 +1,108 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"gt/services"
+	"io"
+	"time"
+)
+
+type Extender struct {
+	ksiExtender    services.KSIExtender
+	archiveService services.ArchiveService
+	backup         bool
+}
+
+// ExtenderOption configures Extender.
+type ExtenderOption func(*Extender)
+
+// ExtenderOptBackup keeps previous container content in file with ".bak" extension when container is rewritten.
+func ExtenderOptBackup(enabled bool) ExtenderOption {
+	return func(e *Extender) {
+		e.backup = enabled
+	}
+}
+
+func NewExtender(ksiExtender services.KSIExtender, archiveService services.ArchiveService, opts ...ExtenderOption) Extender {
+	e := Extender{
+		ksiExtender:    ksiExtender,
+		archiveService: archiveService,
+	}
+
+	for _, opt := range opts {
+		opt(&e)
+	}
+	return e
+}
+
+// Extend extends every signature in container and atomically replaces container file. Manifests are left untouched.
+// Signatures are extended to the publication at pubTime, or to the nearest publication when pubTime is zero.
+func (e Extender) Extend(containerPath string, pubTime time.Time) error {
+	return e.ExtendContext(context.Background(), containerPath, pubTime)
+}
+
+// ExtendContext is Extend which stops when ctx is done, container file is left untouched then.
+func (e Extender) ExtendContext(ctx context.Context, containerPath string, pubTime time.Time) error {
+	return rewriteContainer(containerPath, e.backup, func(r io.ReaderAt, size int64, w io.Writer) error {
+		return e.ExtendStreamContext(ctx, r, size, w, pubTime)
+	})
+}
+
+// ExtendStream reads container from r, extends every signature in it and writes result into w. See Extend.
+// Entries other than signatures are copied without recompression.
+func (e Extender) ExtendStream(r io.ReaderAt, size int64, w io.Writer, pubTime time.Time) error {
+	return e.ExtendStreamContext(context.Background(), r, size, w, pubTime)
+}
+
+// ExtendStreamContext is ExtendStream which stops when ctx is done.
+func (e Extender) ExtendStreamContext(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, pubTime time.Time) error {
+	entries, err := e.archiveService.ReadArchive(r, size)
+	if err != nil {
+		return err
+	}
+
+	l := detectLayout(entries)
+	var extended []services.ArchiveEntry
+	for _, entry := range entries {
+		if !l.isSignature(entry.Name) {
+			continue
+		}
+
+		extendedEntry, err := e.extendSignature(ctx, entry, pubTime)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		extended = append(extended, extendedEntry)
+	}
+
+	if len(extended) == 0 {
+		return ErrNoSignatures
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return e.archiveService.ReplaceArchive(r, size, extended, w)
+}
+
+func (e Extender) extendSignature(ctx context.Context, sigEntry services.ArchiveEntry, pubTime time.Time) (services.ArchiveEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return services.ArchiveEntry{}, err
+	}
+
+	sig, err := readEntry(sigEntry)
+	if err != nil {
+		return services.ArchiveEntry{}, err
+	}
+
+	extendedSig, err := e.ksiExtender.Extend(ctx, sig, pubTime)
+	if err != nil {
+		if ctx.Err() != nil {
+			return services.ArchiveEntry{}, ctx.Err()
+		}
+		return services.ArchiveEntry{}, withKind(ErrKSIExtend, err)
+	}
+
+	return bytesEntry(sigEntry.Name, extendedSig), nil
+}
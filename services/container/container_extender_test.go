@@ -0,0 +1,191 @@
+package container_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"gt/services"
+	"gt/services/container"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtend_ReadArchiveFails(t *testing.T) {
+	expectedErr := errors.New("failed to read archive")
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return nil, expectedErr
+		},
+	}
+
+	var ksiExtender services.KSIExtenderMock
+
+	extender := container.NewExtender(ksiExtender, archiveService)
+
+	// Act
+	err := extender.ExtendStream(bytes.NewReader(nil), 0, ioutil.Discard, time.Time{})
+
+	// Assert
+	if err != expectedErr {
+		t.Fatalf("expected error '%s' but received '%s'", expectedErr, err)
+	}
+}
+
+func TestExtend_ExtendingFails(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+	}
+
+	expectedErr := errors.New("failed to extend")
+	ksiExtender := services.KSIExtenderMock{
+		ExtendFunc: func(ctx context.Context, sig []byte, pubTime time.Time) ([]byte, error) {
+			return nil, expectedErr
+		},
+	}
+
+	extender := container.NewExtender(ksiExtender, archiveService)
+
+	// Act
+	err := extender.ExtendStream(bytes.NewReader(nil), 0, ioutil.Discard, time.Time{})
+
+	// Assert
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected error '%s' but received '%s'", expectedErr, err)
+	}
+}
+
+func TestExtend_SignaturesRewritten(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+		ReplaceArchiveFunc: func(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+			// Only signatures are replaced, manifests and data files are copied as they are.
+			if len(entries) != 1 || entries[0].Name != "META-INF/manifest1.json.sig" {
+				t.Fatalf("expected only signature to be replaced, got %v", entries)
+			}
+
+			sig, err := readTestEntry(entries[0])
+			if err != nil {
+				return err
+			}
+
+			if string(sig) != "extended signature" {
+				t.Errorf("signature was not rewritten! got=%s", sig)
+			}
+			return nil
+		},
+	}
+
+	pubTime := time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)
+	ksiExtender := services.KSIExtenderMock{
+		ExtendFunc: func(ctx context.Context, sig []byte, to time.Time) ([]byte, error) {
+			if !to.Equal(pubTime) {
+				t.Errorf("invalid publication time! got=%v, want=%v", to, pubTime)
+			}
+			return []byte("extended " + string(sig)), nil
+		},
+	}
+
+	extender := container.NewExtender(ksiExtender, archiveService)
+
+	// Act
+	err := extender.ExtendStream(bytes.NewReader(nil), 0, ioutil.Discard, pubTime)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestExtend_EntriesCopiedRaw(t *testing.T) {
+	archive := testZip(t,
+		testZipEntry{name: "text1.txt", content: strings.Repeat("content", 100)},
+		testZipEntry{name: "META-INF/manifest1.json", content: testManifest},
+		testZipEntry{name: "META-INF/manifest1.json.sig", content: "signature"},
+	)
+	ksiExtender := services.KSIExtenderMock{
+		ExtendFunc: func(ctx context.Context, sig []byte, to time.Time) ([]byte, error) {
+			return []byte("extended " + string(sig)), nil
+		},
+	}
+	extender := container.NewExtender(ksiExtender, container.NewZipArchiveService())
+
+	// Act
+	var buf bytes.Buffer
+	err := extender.ExtendStream(bytes.NewReader(archive), int64(len(archive)), &buf, time.Time{})
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	original, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal("failed to read original archive:", err)
+	}
+	extended, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("failed to read extended archive:", err)
+	}
+	if len(extended.File) != 3 {
+		t.Fatalf("invalid entries of extended archive: %v", extended.File)
+	}
+	for i := 0; i < 2; i++ {
+		if extended.File[i].Name != original.File[i].Name || rawContent(t, extended.File[i]) != rawContent(t, original.File[i]) {
+			t.Errorf("expected entry '%s' to be copied without recompression", original.File[i].Name)
+		}
+	}
+	rc, err := extended.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	sig, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extended.File[2].Name != "META-INF/manifest1.json.sig" || string(sig) != "extended signature" {
+		t.Errorf("expected signature to be replaced in place, got '%s': %s", extended.File[2].Name, sig)
+	}
+}
+
+func TestExtend_Cancelled(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ksiExtender := services.KSIExtenderMock{
+		ExtendFunc: func(ctx context.Context, sig []byte, to time.Time) ([]byte, error) {
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+	extender := container.NewExtender(ksiExtender, archiveService)
+
+	// Act
+	err := extender.ExtendStreamContext(ctx, bytes.NewReader(nil), 0, ioutil.Discard, time.Time{})
+
+	// Assert
+	if !errors.Is(err, context.Canceled) || errors.Is(err, container.ErrKSIExtend) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func readTestEntry(entry services.ArchiveEntry) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
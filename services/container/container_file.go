@@ -0,0 +1,221 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// newWorkspace creates private working directory of a single operation under root.
+// Default directory for temporary files is used when root is empty. Cleanup removes the workspace with its content.
+func newWorkspace(root, operation string) (dir string, cleanup func(), err error) {
+	if root != "" {
+		if err := os.MkdirAll(root, 0700); err != nil {
+			return "", nil, err
+		}
+	}
+
+	dir, err = os.MkdirTemp(root, "gt-"+operation+"-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// readContainer opens container file and passes its content to fn.
+func readContainer(containerPath string, fn func(r io.ReaderAt, size int64) error) error {
+	f, err := os.Open(containerPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return fn(f, info.Size())
+}
+
+// writeContainer writes container with fn into temporary file next to containerPath, syncs it to disk and
+// renames it over containerPath, so containerPath is either untouched or fully replaced.
+// Previous content is kept in file with backupExtension when backup is set.
+func writeContainer(containerPath string, backup bool, fn func(w io.Writer) error) (err error) {
+	mode := os.FileMode(0644)
+	info, err := os.Stat(containerPath)
+	switch {
+	case err == nil:
+		mode = info.Mode().Perm()
+	case os.IsNotExist(err):
+		backup = false
+	default:
+		return err
+	}
+
+	dir := filepath.Dir(containerPath)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(containerPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := fn(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if backup {
+		if err := backupFile(containerPath); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), containerPath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rewriteContainer passes content of container file to fn and replaces the file with whatever fn writes,
+// see writeContainer. Container file is left untouched when fn fails.
+func rewriteContainer(containerPath string, backup bool, fn func(r io.ReaderAt, size int64, w io.Writer) error) error {
+	return writeContainer(containerPath, backup, func(w io.Writer) error {
+		return readContainer(containerPath, func(r io.ReaderAt, size int64) error {
+			return fn(r, size, w)
+		})
+	})
+}
+
+func writeFile(filePath string, fn func(w io.Writer) error) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFile(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// backupFile keeps current content of file in file with backupExtension, replacing previous backup.
+func backupFile(filePath string) error {
+	backupPath := filePath + backupExtension
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Hard link is cheap, content is copied when file system does not support links.
+	if err := os.Link(filePath, backupPath); err == nil {
+		return nil
+	}
+	return copyFile(filePath, backupPath)
+}
+
+// syncDir flushes directory entries, so that rename survives crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Directories can not be synced on some platforms, rename is still done.
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+// checkOutputDir returns error when dir exists and is not an empty directory.
+func checkOutputDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("output path '%s' is not a directory", dir)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("output directory '%s' is not empty", dir)
+	}
+	return nil
+}
+
+// moveDir moves src directory to dst which must not exist or be empty, see checkOutputDir.
+// Content is copied when directories are on different file systems.
+func moveDir(src, dst string) error {
+	if err := checkOutputDir(dst); err != nil {
+		return err
+	}
+
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		return copyFile(p, target)
+	})
+	if err != nil {
+		os.RemoveAll(dst)
+	}
+	return err
+}
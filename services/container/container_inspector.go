@@ -0,0 +1,255 @@
+package container
+
+import (
+	"fmt"
+	"gt/domain/manifest"
+	"gt/services"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+)
+
+// ContainerInfo describes container content.
+type ContainerInfo struct {
+	Format     Format          `json:"format"`
+	DataFiles  []DataFileInfo  `json:"data_files"`
+	Signatures []SignatureInfo `json:"signatures"`
+}
+
+// DataFileInfo describes single data file in container.
+type DataFileInfo struct {
+	Uri           string `json:"uri"`
+	Size          int64  `json:"size"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	Hash          string `json:"hash"`
+}
+
+// SignatureInfo describes single manifest and its KSI signature.
+type SignatureInfo struct {
+	// ID is stable id of the signature, 0 when manifest has none and container has to be migrated.
+	ID           int    `json:"id"`
+	ManifestUri  string `json:"manifest_uri"`
+	SignatureUri string `json:"signature_uri"`
+	// Files lists data files covered by manifest.
+	Files []string `json:"files"`
+	// HashAlgorithms lists hash algorithms used for data files in manifest.
+	HashAlgorithms []string `json:"hash_algorithms"`
+	// ManifestVersion is empty for manifests which predate versioning, they have no metadata either.
+	ManifestVersion string                 `json:"manifest_version,omitempty"`
+	Created         *time.Time             `json:"created,omitempty"`
+	Tool            string                 `json:"tool,omitempty"`
+	Signer          *manifest.SignerClaims `json:"signer,omitempty"`
+	// PreviousManifests lists manifests which were in container when manifest was created.
+	PreviousManifests []manifest.ManifestReference `json:"previous_manifests,omitempty"`
+	// KSI is nil when signature could not be read, Error describes the reason.
+	KSI   *services.KSISignatureInfo `json:"ksi,omitempty"`
+	Error string                     `json:"error,omitempty"`
+}
+
+type Inspector struct {
+	ksiInspector   services.KSIInspector
+	archiveService services.ArchiveService
+}
+
+func NewInspector(ksiInspector services.KSIInspector, archiveService services.ArchiveService) Inspector {
+	return Inspector{
+		ksiInspector:   ksiInspector,
+		archiveService: archiveService,
+	}
+}
+
+// Info reads container content without extracting it. Nothing is verified.
+func (i Inspector) Info(containerPath string) (ContainerInfo, error) {
+	var info ContainerInfo
+	err := readContainer(containerPath, func(r io.ReaderAt, size int64) error {
+		var err error
+		info, err = i.InfoStream(r, size)
+		return err
+	})
+	return info, err
+}
+
+// InfoStream reads content of container read from r. See Info.
+func (i Inspector) InfoStream(r io.ReaderAt, size int64) (ContainerInfo, error) {
+	entries, err := i.archiveService.ReadArchive(r, size)
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+
+	files := make(map[string]services.ArchiveEntry, len(entries))
+	for _, e := range entries {
+		files[e.Name] = e
+	}
+
+	l := detectLayout(entries)
+	info := ContainerInfo{
+		Format:     l.format(),
+		DataFiles:  []DataFileInfo{},
+		Signatures: []SignatureInfo{},
+	}
+
+	for _, e := range entries {
+		if id, ok := l.manifestID(e.Name); ok || l.isManifest(e.Name) {
+			sigInfo := i.signatureInfo(id, e, files, l)
+			if !ok && sigInfo.Error == "" {
+				sigInfo.Error = ErrNoSignatureID.Error()
+			}
+			info.Signatures = append(info.Signatures, sigInfo)
+			continue
+		}
+
+		if !l.isDataFile(e.Name) {
+			continue
+		}
+
+		dataFile, err := i.dataFileInfo(e)
+		if err != nil {
+			return ContainerInfo{}, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		info.DataFiles = append(info.DataFiles, dataFile)
+	}
+
+	sortSignatures(info.Signatures)
+	return info, nil
+}
+
+// Manifests reads manifests of container like Info, but neither hashes data files nor reads signatures,
+// so that it is cheap for large containers. KSI of returned signatures is nil.
+func (i Inspector) Manifests(containerPath string) ([]SignatureInfo, error) {
+	var sigs []SignatureInfo
+	err := readContainer(containerPath, func(r io.ReaderAt, size int64) error {
+		var err error
+		sigs, err = i.ManifestsStream(r, size)
+		return err
+	})
+	return sigs, err
+}
+
+// ManifestsStream reads manifests of container read from r. See Manifests.
+func (i Inspector) ManifestsStream(r io.ReaderAt, size int64) ([]SignatureInfo, error) {
+	entries, err := i.archiveService.ReadArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	l := detectLayout(entries)
+	sigs := []SignatureInfo{}
+	for _, e := range entries {
+		if id, ok := l.manifestID(e.Name); ok || l.isManifest(e.Name) {
+			sigInfo, err := manifestInfo(id, e, l)
+			if err != nil {
+				sigInfo.Error = err.Error()
+			} else if !ok {
+				sigInfo.Error = ErrNoSignatureID.Error()
+			}
+			sigs = append(sigs, sigInfo)
+		}
+	}
+
+	sortSignatures(sigs)
+	return sigs, nil
+}
+
+func sortSignatures(sigs []SignatureInfo) {
+	sort.Slice(sigs, func(a, b int) bool {
+		return sigs[a].ID < sigs[b].ID
+	})
+}
+
+// Format detects format of container without reading its signatures.
+func (i Inspector) Format(containerPath string) (Format, error) {
+	var format Format
+	err := readContainer(containerPath, func(r io.ReaderAt, size int64) error {
+		entries, err := i.archiveService.ReadArchive(r, size)
+		if err != nil {
+			return err
+		}
+
+		format = detectLayout(entries).format()
+		return nil
+	})
+	return format, err
+}
+
+func (i Inspector) dataFileInfo(entry services.ArchiveEntry) (DataFileInfo, error) {
+	digest, size, err := hashEntry(entry, hash.Default)
+	if err != nil {
+		return DataFileInfo{}, err
+	}
+
+	return DataFileInfo{
+		Uri:           entry.Name,
+		Size:          size,
+		HashAlgorithm: hash.Default.String(),
+		Hash:          digest,
+	}, nil
+}
+
+// signatureInfo reads manifest and its signature. Files maps container paths to container entries.
+func (i Inspector) signatureInfo(id int, manifestEntry services.ArchiveEntry, files map[string]services.ArchiveEntry, l layout) SignatureInfo {
+	info, err := manifestInfo(id, manifestEntry, l)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	sigEntry, ok := files[info.SignatureUri]
+	if !ok {
+		info.Error = fmt.Sprintf("signature '%s' is missing from container", info.SignatureUri)
+		return info
+	}
+
+	sig, err := readEntry(sigEntry)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	ksiInfo, err := i.ksiInspector.Inspect(sig)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.KSI = &ksiInfo
+
+	return info
+}
+
+// manifestInfo describes manifest without reading its signature.
+func manifestInfo(id int, manifestEntry services.ArchiveEntry, l layout) (SignatureInfo, error) {
+	info := SignatureInfo{
+		ID:             id,
+		ManifestUri:    manifestEntry.Name,
+		Files:          []string{},
+		HashAlgorithms: []string{},
+	}
+
+	manifestBytes, err := readEntry(manifestEntry)
+	if err != nil {
+		return info, err
+	}
+
+	model, err := l.unmarshalManifest(manifestBytes)
+	if err != nil {
+		return info, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	info.SignatureUri = manifestSignatureUri(model, id, l)
+	info.ManifestVersion = model.Version
+	info.Created = model.Created
+	info.Tool = model.Tool
+	info.Signer = model.Signer
+	info.PreviousManifests = model.PreviousManifests
+
+	algorithms := make(map[string]bool)
+	for _, df := range model.Files {
+		info.Files = append(info.Files, df.Uri)
+		if !algorithms[df.HashAlgorithm] {
+			algorithms[df.HashAlgorithm] = true
+			info.HashAlgorithms = append(info.HashAlgorithms, df.HashAlgorithm)
+		}
+	}
+	return info, nil
+}
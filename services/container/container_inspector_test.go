@@ -0,0 +1,213 @@
+package container_test
+
+import (
+	"bytes"
+	"errors"
+	"gt/domain/manifest"
+	"gt/services"
+	"gt/services/container"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestInfo_ReadArchiveFails(t *testing.T) {
+	expectedErr := errors.New("failed to read archive")
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return nil, expectedErr
+		},
+	}
+
+	var ksiInspector services.KSIInspectorMock
+
+	inspector := container.NewInspector(ksiInspector, archiveService)
+
+	// Act
+	_, err := inspector.InfoStream(bytes.NewReader(nil), 0)
+
+	// Assert
+	if err != expectedErr {
+		t.Fatalf("expected error '%s' but received '%s'", expectedErr, err)
+	}
+}
+
+func TestInfo_ContainerContentListed(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+	}
+
+	signingTime := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	ksiInspector := services.KSIInspectorMock{
+		InspectFunc: func(sig []byte) (services.KSISignatureInfo, error) {
+			if string(sig) != "signature" {
+				t.Errorf("invalid signature passed to ksi inspector! got=%s", sig)
+			}
+			return services.KSISignatureInfo{SigningTime: signingTime, Identity: []string{"GT", "client"}}, nil
+		},
+	}
+
+	inspector := container.NewInspector(ksiInspector, archiveService)
+
+	// Act
+	info, err := inspector.InfoStream(bytes.NewReader(nil), 0)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expectedFile := container.DataFileInfo{Uri: "text1.txt", Size: 7, HashAlgorithm: "SHA-256", Hash: testFileContentHash}
+	if len(info.DataFiles) != 1 || info.DataFiles[0] != expectedFile {
+		t.Fatalf("invalid data files! got=%+v, want=%+v", info.DataFiles, expectedFile)
+	}
+
+	if len(info.Signatures) != 1 {
+		t.Fatalf("invalid count of signatures! got=%v, want=%v", len(info.Signatures), 1)
+	}
+
+	sig := info.Signatures[0]
+	if sig.ID != 1 || len(sig.Files) != 1 || sig.Files[0] != "text1.txt" || sig.Error != "" {
+		t.Errorf("invalid signature info! got=%+v", sig)
+	}
+
+	if sig.KSI == nil || !sig.KSI.SigningTime.Equal(signingTime) {
+		t.Errorf("invalid ksi signature info! got=%+v", sig.KSI)
+	}
+}
+
+func TestInfo_InvalidSignatureReported(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+	}
+
+	ksiInspector := services.KSIInspectorMock{
+		InspectFunc: func(sig []byte) (services.KSISignatureInfo, error) {
+			return services.KSISignatureInfo{}, errors.New("invalid signature")
+		},
+	}
+
+	inspector := container.NewInspector(ksiInspector, archiveService)
+
+	// Act
+	info, err := inspector.InfoStream(bytes.NewReader(nil), 0)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if sig := info.Signatures[0]; sig.KSI != nil || sig.Error != "invalid signature" {
+		t.Fatalf("expected signature error to be reported! got=%+v", sig)
+	}
+}
+
+func TestInfo_ManifestMetadataListed(t *testing.T) {
+	const manifestWithMetadata = `{"created":"2021-01-10T00:00:00Z",` +
+		`"files":[{"hash":"` + testFileContentHash + `","hash_algorithm":"SHA-256","mime_type":"text/plain","size":7,"uri":"text1.txt"}],` +
+		`"signature_uri":"META-INF/manifest1.json.sig","signer":{"name":"John","reason":"approval"},"tool":"gt","version":"1.3"}`
+
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return []services.ArchiveEntry{
+				testEntry("text1.txt", "content"),
+				testEntry("META-INF/manifest1.json", manifestWithMetadata),
+				testEntry("META-INF/manifest1.json.sig", "signature"),
+			}, nil
+		},
+	}
+
+	ksiInspector := services.KSIInspectorMock{
+		InspectFunc: func(sig []byte) (services.KSISignatureInfo, error) {
+			return services.KSISignatureInfo{}, nil
+		},
+	}
+
+	inspector := container.NewInspector(ksiInspector, archiveService)
+
+	// Act
+	info, err := inspector.InfoStream(bytes.NewReader(nil), 0)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	sig := info.Signatures[0]
+	if sig.Error != "" || sig.ManifestVersion != "1.3" || sig.Tool != "gt" || sig.Created == nil || !sig.Created.Equal(time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid manifest metadata! got=%+v", sig)
+	}
+
+	expectedSigner := manifest.SignerClaims{Name: "John", Reason: "approval"}
+	if sig.Signer == nil || *sig.Signer != expectedSigner {
+		t.Errorf("invalid signer claims! got=%+v, want=%+v", sig.Signer, expectedSigner)
+	}
+}
+
+func TestInfo_UnsupportedManifestVersionReported(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return []services.ArchiveEntry{
+				testEntry("text1.txt", "content"),
+				testEntry("META-INF/manifest1.json", `{"version":"2.0","files":[],"signature_uri":"META-INF/manifest1.json.sig"}`),
+				testEntry("META-INF/manifest1.json.sig", "signature"),
+			}, nil
+		},
+	}
+
+	var ksiInspector services.KSIInspectorMock
+
+	inspector := container.NewInspector(ksiInspector, archiveService)
+
+	// Act
+	info, err := inspector.InfoStream(bytes.NewReader(nil), 0)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expectedErrStr := "invalid manifest: unsupported manifest version: 2.0, newest supported version is " + manifest.Version
+	if info.Signatures[0].Error != expectedErrStr {
+		t.Fatalf("expected error '%s' but received '%s'", expectedErrStr, info.Signatures[0].Error)
+	}
+}
+
+func TestManifests_DataFilesAndSignaturesNotRead(t *testing.T) {
+	entries := testContainerFiles("content")
+	for _, i := range []int{0, 2} {
+		name := entries[i].Name
+		entries[i].Open = func() (io.ReadCloser, error) {
+			t.Errorf("expected '%s' not to be read", name)
+			return nil, errors.New("not readable")
+		}
+	}
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return entries, nil
+		},
+	}
+
+	var ksiInspector services.KSIInspectorMock
+
+	inspector := container.NewInspector(ksiInspector, archiveService)
+
+	// Act
+	sigs, err := inspector.ManifestsStream(bytes.NewReader(nil), 0)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("invalid count of signatures! got=%v, want=%v", len(sigs), 1)
+	}
+	sig := sigs[0]
+	if sig.ID != 1 || sig.SignatureUri != "META-INF/manifest1.json.sig" || len(sig.Files) != 1 || sig.KSI != nil || sig.Error != "" {
+		t.Errorf("invalid signature info! got=%+v", sig)
+	}
+}
@@ -1,95 +1,385 @@
 package container
 
 import (
+	"context"
 	"fmt"
+	"gt/domain/manifest"
 	"gt/services"
-	"os"
-	"strings"
+	"io"
+	"path"
+
+	"github.com/guardtime/goksi/hash"
 )
 
 type Signer struct {
-	sigCreator     SignatureCreator
-	archiveService services.ArchiveService
+	sigCreator            SignatureCreator
+	archiveService        services.ArchiveService
+	dataFileHashAlgorithm hash.Algorithm
+	manifestHashAlgorithm hash.Algorithm
+	backup                bool
+}
+
+// SignerOption configures Signer.
+type SignerOption func(*Signer)
+
+// SignerOptHashAlgorithms selects hash algorithms of data files and manifest of added signatures.
+// Default is hash.Default for both.
+func SignerOptHashAlgorithms(dataFile, manifest hash.Algorithm) SignerOption {
+	return func(s *Signer) {
+		s.dataFileHashAlgorithm = dataFile
+		s.manifestHashAlgorithm = manifest
+	}
+}
+
+// SignerOptBackup keeps previous container content in file with ".bak" extension when container is rewritten.
+func SignerOptBackup(enabled bool) SignerOption {
+	return func(s *Signer) {
+		s.backup = enabled
+	}
 }
 
-func NewSigner(sigCreator SignatureCreator, archiveService services.ArchiveService) Signer {
-	return Signer{
-		sigCreator:     sigCreator,
-		archiveService: archiveService,
+// NewSigner creates signer which adds signatures with sigCreator.
+// SigCreator can be nil when signer only removes signatures or migrates containers.
+func NewSigner(sigCreator SignatureCreator, archiveService services.ArchiveService, opts ...SignerOption) Signer {
+	s := Signer{
+		sigCreator:            sigCreator,
+		archiveService:        archiveService,
+		dataFileHashAlgorithm: hash.Default,
+		manifestHashAlgorithm: hash.Default,
+	}
+
+	for _, opt := range opts {
+		opt(&s)
 	}
+	return s
+}
+
+// AddSignature adds new signature to container and atomically replaces container file.
+// Signature covers data files matching given container paths or glob patterns, all data files when none given.
+func (s Signer) AddSignature(containerPath string, files ...string) error {
+	return s.AddSignatureContext(context.Background(), containerPath, files...)
 }
 
-func (s Signer) AddSignature(containerPath string) error {
-	filePaths, err := s.archiveService.Extract(containerPath)
+// AddSignatureContext is AddSignature which stops when ctx is done, container file is left untouched then.
+func (s Signer) AddSignatureContext(ctx context.Context, containerPath string, files ...string) error {
+	return rewriteContainer(containerPath, s.backup, func(r io.ReaderAt, size int64, w io.Writer) error {
+		return s.AddSignatureStreamContext(ctx, r, size, w, files...)
+	})
+}
+
+// AddSignatureStream reads container from r, adds new signature and writes result into w. See AddSignature.
+// Existing entries are copied without recompression, data files are read only to hash them.
+func (s Signer) AddSignatureStream(r io.ReaderAt, size int64, w io.Writer, files ...string) error {
+	return s.AddSignatureStreamContext(context.Background(), r, size, w, files...)
+}
+
+// AddSignatureStreamContext is AddSignatureStream which stops when ctx is done.
+func (s Signer) AddSignatureStreamContext(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, files ...string) error {
+	entries, err := s.archiveService.ReadArchive(r, size)
 	if err != nil {
 		return err
 	}
 
-	signatureFiles := s.filterFilePathsByPrefix(filePaths, signatureFileExtension)
-	newManifestName := fmt.Sprintf(manifestFileNamePattern, len(signatureFiles)+1)
-	dataFilePaths := s.filterFilePathsNotContaining(filePaths, metaInfPathZip)
+	dataEntries, params, err := s.signatureRequest(entries, files)
+	if err != nil {
+		return err
+	}
 
-	resp, err := s.sigCreator.NewSignature(dataFilePaths, newManifestName)
+	resp, err := s.sigCreator.NewSignature(ctx, dataEntries, params)
 	if err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.archiveService.AppendArchive(r, size, resp.archiveEntries(), w)
+}
 
-	filePaths = append(filePaths, resp.ManifestFilePath, resp.SignatureFilePath)
+// signatureRequest returns data files covered by new signature of container with given entries and its parameters.
+func (s Signer) signatureRequest(entries []services.ArchiveEntry, files []string) ([]services.ArchiveEntry, SignatureParams, error) {
+	l := detectLayout(entries)
+	dataEntries := s.filterEntries(entries, l.isDataFile)
 
-	return s.archiveService.CreateArchive(filePaths, containerPath)
+	if len(files) > 0 {
+		var err error
+		dataEntries, err = s.filterEntriesByPatterns(dataEntries, files)
+		if err != nil {
+			return nil, SignatureParams{}, err
+		}
+	}
+
+	return dataEntries, SignatureParams{
+		ID:                    nextSignatureID(entryNames(entries), l),
+		Format:                l.format(),
+		DataFileHashAlgorithm: s.dataFileHashAlgorithm,
+		ManifestHashAlgorithm: s.manifestHashAlgorithm,
+		PreviousManifests:     s.filterEntries(entries, l.isManifest),
+	}, nil
 }
 
-// RemoveSignature removes specified signature by id. If no such signature found, error is returned.
+// RemoveSignature removes specified signature by id and atomically replaces container file.
+// If no such signature found, error is returned.
 func (s Signer) RemoveSignature(containerPath string, signatureID int) error {
-	filePaths, err := s.archiveService.Extract(containerPath)
+	return rewriteContainer(containerPath, s.backup, func(r io.ReaderAt, size int64, w io.Writer) error {
+		return s.RemoveSignatureStream(r, size, w, signatureID)
+	})
+}
+
+// RemoveSignatureStream reads container from r and writes it into w without specified signature.
+// If no such signature found, error is returned.
+func (s Signer) RemoveSignatureStream(r io.ReaderAt, size int64, w io.Writer, signatureID int) error {
+	entries, err := s.archiveService.ReadArchive(r, size)
 	if err != nil {
 		return err
 	}
 
-	defer os.RemoveAll(tmpFolderPath)
+	l := detectLayout(entries)
+	manifestName := l.manifestUri(signatureID)
 
-	fileName := fmt.Sprintf(manifestFileNamePattern, signatureID)
-	filteredManifestFile := s.filterFilePathsByPrefix(filePaths, fileName)
-	if len(filteredManifestFile) == 0 {
-		return fmt.Errorf("signature with id '%v' not found", signatureID)
+	var signatureName string
+	for _, e := range entries {
+		if e.Name == manifestName {
+			signatureName = signatureEntryUri(e, signatureID, l)
+		}
 	}
 
-	filteredManifestFilePath := filteredManifestFile[0]
-	if err := s.removeSignatureFiles(filteredManifestFilePath); err != nil {
-		return err
+	if signatureName == "" {
+		return fmt.Errorf("%w: id '%v'", ErrSignatureNotFound, signatureID)
 	}
 
-	newFileNames := s.filterFilePathsNotContaining(filePaths, filteredManifestFilePath)
-	return s.archiveService.CreateArchive(newFileNames, containerPath)
+	newEntries := s.filterEntries(entries, func(name string) bool {
+		return name != manifestName && name != signatureName
+	})
+
+	return s.archiveService.CreateArchive(newEntries, w)
+}
+
+// SignatureMigration describes manifest which got stable signature id during migration.
+type SignatureMigration struct {
+	OldManifestUri string
+	ManifestUri    string
+	ID             int
+	// OldSignatureUri and SignatureUri are set when signature was renamed too, see Migrate.
+	OldSignatureUri string
+	SignatureUri    string
 }
 
-func (s Signer) removeSignatureFiles(manifestPath string) error {
-	if err := os.Remove(manifestPath); err != nil {
+// Migrate gives stable ids to manifests which do not have one and atomically replaces container file.
+// Manifests are renamed after their new id, signatures keep their names as manifests refer to them.
+// Duplicate manifests and signatures left by older versions, which reused ids, get new ids in archive order;
+// the first of duplicates keeps its id. Containers whose renamed manifests are referenced by previous_manifests
+// of another manifest are not migrated, as signed manifests can not be changed.
+func (s Signer) Migrate(containerPath string) ([]SignatureMigration, error) {
+	var migrations []SignatureMigration
+	err := rewriteContainer(containerPath, s.backup, func(r io.ReaderAt, size int64, w io.Writer) error {
+		var err error
+		migrations, err = s.MigrateStream(r, size, w)
 		return err
+	})
+	return migrations, err
+}
+
+// MigrateStream reads container from r and writes it into w with stable ids given to every manifest. See Migrate.
+func (s Signer) MigrateStream(r io.ReaderAt, size int64, w io.Writer) ([]SignatureMigration, error) {
+	entries, err := s.archiveService.ReadArchiveWithDuplicates(r, size)
+	if err != nil {
+		return nil, err
 	}
 
-	signatureFileName := fmt.Sprintf(signatureFileNamePattern, manifestPath)
-	if err := os.Remove(signatureFileName); err != nil {
-		return err
+	l := detectLayout(entries)
+	models, err := migrationManifests(entries, l)
+	if err != nil {
+		return nil, err
+	}
+
+	names := entryNames(entries)
+	oldNames := make([]string, len(entries))
+	for i, e := range entries {
+		oldNames[i] = e.Name
+	}
+	seen := make(map[string]int, len(entries))
+	var migrations []SignatureMigration
+	for i, name := range oldNames {
+		seen[name]++
+		id, ok := l.manifestID(name)
+		if ok && seen[name] == 1 {
+			continue
+		}
+		if !l.isManifest(name) {
+			if seen[name] > 1 && !l.isSignature(name) {
+				return nil, fmt.Errorf("%w: entry '%s' is duplicated", ErrCannotMigrate, name)
+			}
+			continue
+		}
+
+		m := SignatureMigration{OldManifestUri: name, ID: nextSignatureID(names, l)}
+		m.ManifestUri = l.manifestUri(m.ID)
+		if seen[name] > 1 {
+			// Duplicate manifest is paired with the same occurrence of its signature, which is named after the id.
+			if !ok {
+				return nil, fmt.Errorf("%w: manifest '%s' without id is duplicated", ErrCannotMigrate, name)
+			}
+			m.OldSignatureUri = manifestSignatureUri(models[i], id, l)
+			j := nthName(oldNames, m.OldSignatureUri, seen[name])
+			if sigID, _ := l.signatureID(m.OldSignatureUri); sigID != id || j < 0 {
+				return nil, fmt.Errorf("%w: signature of duplicate manifest '%s' is missing", ErrCannotMigrate, name)
+			}
+			m.SignatureUri = l.signatureUri(m.ID)
+			entries[j].Name = m.SignatureUri
+			names[m.SignatureUri] = true
+		}
+
+		entries[i].Name = m.ManifestUri
+		names[m.ManifestUri] = true
+		migrations = append(migrations, m)
+	}
+
+	if err := checkMigrated(entries, models, migrations); err != nil {
+		return nil, err
+	}
+
+	if len(migrations) == 0 {
+		return nil, s.archiveService.AppendArchive(r, size, nil, w)
+	}
+	return migrations, s.archiveService.CreateArchive(entries, w)
+}
+
+// migrationManifests reads manifests of container, models are indexed like entries.
+// Invalid manifests are left out, they are renamed without looking into them.
+func migrationManifests(entries []services.ArchiveEntry, l layout) (map[int]manifest.Model, error) {
+	models := make(map[int]manifest.Model)
+	for i, e := range entries {
+		if !l.isManifest(e.Name) {
+			continue
+		}
+
+		b, err := readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		if model, err := l.unmarshalManifest(b); err == nil {
+			models[i] = model
+		}
+	}
+	return models, nil
+}
+
+// checkMigrated returns error when signatures are still duplicated after migration or when any manifest
+// refers to old name of renamed manifest in its previous manifests.
+func checkMigrated(entries []services.ArchiveEntry, models map[int]manifest.Model, migrations []SignatureMigration) error {
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if names[e.Name] {
+			return fmt.Errorf("%w: entry '%s' is duplicated", ErrCannotMigrate, e.Name)
+		}
+		names[e.Name] = true
+	}
+
+	renamed := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		renamed[m.OldManifestUri] = true
+	}
+	for i, model := range models {
+		for _, ref := range model.PreviousManifests {
+			if renamed[ref.Uri] {
+				return fmt.Errorf("%w: manifest '%s' refers to renamed manifest '%s'", ErrCannotMigrate, entries[i].Name, ref.Uri)
+			}
+		}
 	}
 	return nil
 }
 
-func (s Signer) filterFilePathsNotContaining(paths []string, notContains string) []string {
-	var newFilePaths []string
-	for _, fn := range paths {
-		if !strings.Contains(fn, notContains) {
-			newFilePaths = append(newFilePaths, fn)
+// nthName returns index of n-th occurrence of name, counting from 1, or -1 when there is no such occurrence.
+func nthName(names []string, name string, n int) int {
+	for i, other := range names {
+		if other != name {
+			continue
+		}
+		if n--; n == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextSignatureID returns id following the largest id in container whose manifest and signature names are both free.
+// Ids of removed signatures are not reused unless they were the largest ones.
+func nextSignatureID(names map[string]bool, l layout) int {
+	id := initialSignatureID
+	for name := range names {
+		if n, ok := l.manifestID(name); ok && n >= id {
+			id = n + 1
+		}
+	}
+
+	for names[l.manifestUri(id)] || names[l.signatureUri(id)] {
+		id++
+	}
+	return id
+}
+
+// signatureEntryUri returns container path of signature of manifest with given id, see manifestSignatureUri.
+// Default signature path of the id is returned when manifest can not be read, so that removal never
+// deletes entries which are not signatures.
+func signatureEntryUri(manifestEntry services.ArchiveEntry, id int, l layout) string {
+	b, err := readEntry(manifestEntry)
+	if err != nil {
+		return l.signatureUri(id)
+	}
+
+	model, err := l.unmarshalManifest(b)
+	if err != nil {
+		return l.signatureUri(id)
+	}
+	return manifestSignatureUri(model, id, l)
+}
+
+func entryNames(entries []services.ArchiveEntry) map[string]bool {
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		names[e.Name] = true
+	}
+	return names
+}
+
+// filterEntriesByPatterns returns entries which name matches any of given container paths or glob patterns.
+// Every pattern must match at least one entry.
+func (s Signer) filterEntriesByPatterns(entries []services.ArchiveEntry, patterns []string) ([]services.ArchiveEntry, error) {
+	matched := make([]bool, len(entries))
+	for _, p := range patterns {
+		var found bool
+		for i, e := range entries {
+			ok, err := path.Match(p, e.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern '%s': %w", p, err)
+			}
+
+			if ok {
+				matched[i] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("no data file matches '%s'", p)
+		}
+	}
+
+	var filtered []services.ArchiveEntry
+	for i, e := range entries {
+		if matched[i] {
+			filtered = append(filtered, e)
 		}
 	}
-	return newFilePaths
+	return filtered, nil
 }
 
-func (s Signer) filterFilePathsByPrefix(paths []string, prefix string) []string {
-	filtered := make([]string, 0, len(paths))
-	for _, fn := range paths {
-		if strings.Contains(fn, prefix) {
-			filtered = append(filtered, fn)
+func (s Signer) filterEntries(entries []services.ArchiveEntry, match func(name string) bool) []services.ArchiveEntry {
+	var filtered []services.ArchiveEntry
+	for _, e := range entries {
+		if match(e.Name) {
+			filtered = append(filtered, e)
 		}
 	}
 	return filtered
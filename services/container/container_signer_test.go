@@ -1,17 +1,28 @@
 package container_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"gt/services"
 	"gt/services/container"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
 )
 
-func TestAddSignature_ExtractFails(t *testing.T) {
-	expectedErr := errors.New("failed to extract")
+func TestAddSignature_ReadArchiveFails(t *testing.T) {
+	expectedErr := errors.New("failed to read archive")
 	archiveService := services.ArchiveServiceMock{
-		ExtractFunc: func(archivePath string) ([]string, error) {
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
 			return nil, expectedErr
 		},
 	}
@@ -21,7 +32,7 @@ func TestAddSignature_ExtractFails(t *testing.T) {
 	signer := container.NewSigner(sigCreator, archiveService)
 
 	// Act
-	err := signer.AddSignature("container.zip")
+	err := signer.AddSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard)
 
 	// Assert
 	if err != expectedErr {
@@ -31,14 +42,14 @@ func TestAddSignature_ExtractFails(t *testing.T) {
 
 func TestAddSignature_CreatingNewSignatureFails(t *testing.T) {
 	archiveService := services.ArchiveServiceMock{
-		ExtractFunc: func(archivePath string) ([]string, error) {
-			return []string{"text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"}, nil
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
 		},
 	}
 
 	expectedErr := errors.New("failed to sign")
 	sigCreator := container.SignatureCreatorMock{
-		NewSignatureFunc: func(filePaths []string, manifestName string) (container.SignatureCreatorResponse, error) {
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
 			return container.SignatureCreatorResponse{}, expectedErr
 		},
 	}
@@ -46,7 +57,7 @@ func TestAddSignature_CreatingNewSignatureFails(t *testing.T) {
 	signer := container.NewSigner(sigCreator, archiveService)
 
 	// Act
-	err := signer.AddSignature("container.zip")
+	err := signer.AddSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard)
 
 	// Assert
 	if err != expectedErr {
@@ -54,21 +65,17 @@ func TestAddSignature_CreatingNewSignatureFails(t *testing.T) {
 	}
 }
 
-func TestAddSignature_CreatingArchiveFails(t *testing.T) {
-	expectedErr := errors.New("failed to create archive")
+func TestAddSignature_AppendingArchiveFails(t *testing.T) {
+	expectedErr := errors.New("failed to append archive")
 
 	archiveService := services.ArchiveServiceMock{
-		ExtractFunc: func(archivePath string) ([]string, error) {
-			return []string{"text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"}, nil
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
 		},
-		CreateArchiveFunc: func(filePaths []string, destinationPath string) error {
-			if destinationPath == "" {
-				return errors.New("destination is empty")
-			}
-
-			if len(filePaths) != 5 {
-				t.Error(filePaths)
-				return errors.New("invalid count of file paths in creatArchive mock")
+		AppendArchiveFunc: func(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+			if len(entries) != 2 {
+				t.Error(entries)
+				return errors.New("invalid count of file paths in appendArchive mock")
 			}
 
 			return expectedErr
@@ -76,19 +83,21 @@ func TestAddSignature_CreatingArchiveFails(t *testing.T) {
 	}
 
 	sigCreator := container.SignatureCreatorMock{
-		NewSignatureFunc: func(filePaths []string, manifestName string) (container.SignatureCreatorResponse, error) {
-			if len(filePaths) != 1 {
-				t.Error(filePaths)
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			if len(files) != 1 {
+				t.Error(files)
 				return container.SignatureCreatorResponse{}, errors.New("invalid count of filepaths in signature creator mock")
 			}
 
-			if manifestName == "" {
-				return container.SignatureCreatorResponse{}, errors.New("manifest name is empty")
+			if params.ID != 2 || params.Format != container.FormatJSON {
+				return container.SignatureCreatorResponse{}, fmt.Errorf("invalid signature id %v or format %s", params.ID, params.Format)
 			}
 
 			return container.SignatureCreatorResponse{
-				ManifestFilePath:  "META-INF/manifest2.json",
-				SignatureFilePath: "META-INF/manifest2.json.sig",
+				ManifestUri:  "META-INF/manifest2.json",
+				Manifest:     []byte("manifest"),
+				SignatureUri: "META-INF/manifest2.json.sig",
+				Signature:    []byte("signature"),
 			}, nil
 		},
 	}
@@ -96,7 +105,7 @@ func TestAddSignature_CreatingArchiveFails(t *testing.T) {
 	signer := container.NewSigner(sigCreator, archiveService)
 
 	// Act
-	err := signer.AddSignature("container.zip")
+	err := signer.AddSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard)
 
 	// Assert
 	if err != expectedErr {
@@ -104,10 +113,10 @@ func TestAddSignature_CreatingArchiveFails(t *testing.T) {
 	}
 }
 
-func TestRemoveSignature_ExtractFails(t *testing.T) {
-	expectedErr := errors.New("failed to extract")
+func TestRemoveSignature_ReadArchiveFails(t *testing.T) {
+	expectedErr := errors.New("failed to read archive")
 	archiveService := services.ArchiveServiceMock{
-		ExtractFunc: func(archivePath string) ([]string, error) {
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
 			return nil, expectedErr
 		},
 	}
@@ -117,7 +126,7 @@ func TestRemoveSignature_ExtractFails(t *testing.T) {
 	signer := container.NewSigner(sigCreator, archiveService)
 
 	// Act
-	err := signer.RemoveSignature("container.zip", 1)
+	err := signer.RemoveSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, 1)
 
 	// Assert
 	if err != expectedErr {
@@ -127,37 +136,34 @@ func TestRemoveSignature_ExtractFails(t *testing.T) {
 
 func TestRemoveSignature_SignatureWithGivenIDNotFound(t *testing.T) {
 	archiveService := services.ArchiveServiceMock{
-		ExtractFunc: func(archivePath string) ([]string, error) {
-			return []string{"text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"}, nil
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
 		},
 	}
 
-	expectedErrStr := "signature with id '2' not found"
+	expectedErrStr := "signature not found: id '2'"
 	var sigCreator container.SignatureCreatorMock
 
 	signer := container.NewSigner(sigCreator, archiveService)
 
 	// Act
-	err := signer.RemoveSignature("container.zip", 2)
+	err := signer.RemoveSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, 2)
 
 	// Assert
-	if err.Error() != expectedErrStr {
-		t.Fatalf("expected error '%s' but received '%s'", expectedErrStr, err)
+	if !errors.Is(err, container.ErrSignatureNotFound) || err.Error() != expectedErrStr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErrStr, err)
 	}
 }
 
 func TestRemoveSignature_CreateArchiveFails(t *testing.T) {
-	testSetup(t)
-	defer cleanup(t)
-
 	expectedErr := errors.New("create archive error")
 	archiveService := services.ArchiveServiceMock{
-		ExtractFunc: func(archivePath string) ([]string, error) {
-			return []string{"text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"}, nil
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
 		},
-		CreateArchiveFunc: func(filePaths []string, destinationPath string) error {
-			if len(filePaths) != 1 {
-				t.Error(filePaths)
+		CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+			if len(entries) != 1 {
+				t.Error(entries)
 				return errors.New("invalid count of filepaths in creatArchive mock")
 			}
 
@@ -170,7 +176,7 @@ func TestRemoveSignature_CreateArchiveFails(t *testing.T) {
 	signer := container.NewSigner(sigCreator, archiveService)
 
 	// Act
-	err := signer.RemoveSignature("container.zip", 1)
+	err := signer.RemoveSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, 1)
 
 	// Assert
 	if err != expectedErr {
@@ -178,22 +184,411 @@ func TestRemoveSignature_CreateArchiveFails(t *testing.T) {
 	}
 }
 
-func testSetup(t *testing.T) {
-	os.MkdirAll("META-INF", 0777)
+// testEntries returns in-memory container entries. Content of each entry is its name.
+func testEntries(names ...string) []services.ArchiveEntry {
+	entries := make([]services.ArchiveEntry, 0, len(names))
+	for _, n := range names {
+		entries = append(entries, testEntry(n, n))
+	}
+	return entries
+}
+
+func testEntry(name, content string) services.ArchiveEntry {
+	return container.NewDataFile(name, strings.NewReader(content), int64(len(content)))
+}
+
+func TestAddSignature_SubsetOfFiles(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("docs/a.txt", "docs/b.pdf", "c.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
+		},
+		AppendArchiveFunc: func(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+			return nil
+		},
+	}
+
+	expectedNames := []string{"docs/a.txt", "c.txt"}
+	sigCreator := container.SignatureCreatorMock{
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			if len(files) != len(expectedNames) {
+				t.Fatalf("invalid count of files! got=%v, want=%v", len(files), len(expectedNames))
+			}
+
+			for i, f := range files {
+				if f.Name != expectedNames[i] {
+					t.Errorf("invalid file! got=%v, want=%v", f.Name, expectedNames[i])
+				}
+			}
+
+			return container.SignatureCreatorResponse{
+				ManifestUri:  "META-INF/manifest2.json",
+				SignatureUri: "META-INF/manifest2.json.sig",
+			}, nil
+		},
+	}
+
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	err := signer.AddSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, "docs/*.txt", "c.txt")
 
-	f, err := os.Create("META-INF/manifest1.json")
+	// Assert
 	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestAddSignature_PatternMatchesNoFile(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
+		},
+	}
+
+	var sigCreator container.SignatureCreatorMock
+
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	err := signer.AddSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, "*.pdf")
+
+	// Assert
+	expectedErrStr := "no data file matches '*.pdf'"
+	if err == nil || err.Error() != expectedErrStr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErrStr, err)
+	}
+}
+
+func TestAddSignature_WorkspaceRemovedOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	containerPath := filepath.Join(dir, "container.zip")
+	if err := ioutil.WriteFile(containerPath, []byte("original"), 0644); err != nil {
 		t.Fatal("failed to setup test:", err)
 	}
-	defer f.Close()
 
-	f2, err := os.Create("META-INF/manifest1.json.sig")
-	if err != nil {
+	expectedErr := errors.New("failed to append archive")
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
+		},
+		AppendArchiveFunc: func(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+			w.Write([]byte("partial"))
+			return expectedErr
+		},
+	}
+
+	sigCreator := container.SignatureCreatorMock{
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			return container.SignatureCreatorResponse{
+				ManifestUri:  "META-INF/manifest2.json",
+				SignatureUri: "META-INF/manifest2.json.sig",
+			}, nil
+		},
+	}
+
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	err := signer.AddSignature(containerPath)
+
+	// Assert
+	if err != expectedErr {
+		t.Fatalf("expected error '%s' but received '%v'", expectedErr, err)
+	}
+
+	if content, _ := ioutil.ReadFile(containerPath); string(content) != "original" {
+		t.Errorf("expected container to be untouched but it has content '%s'", content)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected no temporary files next to container but directory has %v entries", len(files))
+	}
+}
+
+func TestRemoveSignature_BackupKept(t *testing.T) {
+	dir := t.TempDir()
+	containerPath := filepath.Join(dir, "container.zip")
+	if err := ioutil.WriteFile(containerPath, []byte("original"), 0644); err != nil {
 		t.Fatal("failed to setup test:", err)
 	}
-	defer f2.Close()
+
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
+		},
+		CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+			_, err := w.Write([]byte("rewritten"))
+			return err
+		},
+	}
+
+	var sigCreator container.SignatureCreatorMock
+	signer := container.NewSigner(sigCreator, archiveService, container.SignerOptBackup(true))
+
+	// Act
+	err := signer.RemoveSignature(containerPath, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for p, expected := range map[string]string{containerPath: "rewritten", containerPath + ".bak": "original"} {
+		if content, err := ioutil.ReadFile(p); err != nil || string(content) != expected {
+			t.Errorf("invalid content of '%s'! got=%s, want=%s, err=%v", p, content, expected, err)
+		}
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("expected no temporary files to be left but directory has %v entries", len(files))
+	}
 }
 
-func cleanup(t *testing.T) {
-	os.RemoveAll("META-INF")
+func TestAddSignature_IDOfRemovedSignatureNotReused(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest2.json", "META-INF/manifest2.json.sig"), nil
+		},
+		AppendArchiveFunc: func(r io.ReaderAt, size int64, entries []services.ArchiveEntry, w io.Writer) error {
+			return nil
+		},
+	}
+
+	sigCreator := container.SignatureCreatorMock{
+		NewSignatureFunc: func(ctx context.Context, files []services.ArchiveEntry, params container.SignatureParams) (container.SignatureCreatorResponse, error) {
+			if params.ID != 3 {
+				t.Errorf("invalid signature id! got=%v, want=%v", params.ID, 3)
+			}
+			return container.SignatureCreatorResponse{}, nil
+		},
+	}
+
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	err := signer.AddSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestRemoveSignature_SignatureReferencedByManifestRemoved(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return []services.ArchiveEntry{
+				testEntry("text1.txt", "text1.txt"),
+				testEntry("META-INF/manifest1.json", `{"signature_uri": "META-INF/signature.sig"}`),
+				testEntry("META-INF/signature.sig", "signature"),
+			}, nil
+		},
+		CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+			if len(entries) != 1 || entries[0].Name != "text1.txt" {
+				t.Errorf("expected only data file to be left but got %v", entries)
+			}
+			return nil
+		},
+	}
+
+	var sigCreator container.SignatureCreatorMock
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	err := signer.RemoveSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestRemoveSignature_ManifestReferringToOtherEntryRejected(t *testing.T) {
+	for _, signatureUri := range []string{"report.txt", "META-INF/manifest2.json", "META-INF/manifest2.json.sig"} {
+		archiveService := services.ArchiveServiceMock{
+			ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+				return []services.ArchiveEntry{
+					testEntry("report.txt", "report.txt"),
+					testEntry("META-INF/manifest1.json", `{"signature_uri": "`+signatureUri+`"}`),
+					testEntry("META-INF/manifest1.json.sig", "signature"),
+					testEntry("META-INF/manifest2.json", `{"signature_uri": "META-INF/manifest2.json.sig"}`),
+					testEntry("META-INF/manifest2.json.sig", "signature"),
+				}, nil
+			},
+			CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name)
+				}
+				expected := "report.txt,META-INF/manifest2.json,META-INF/manifest2.json.sig"
+				if strings.Join(names, ",") != expected {
+					t.Errorf("signature_uri %s: expected entries %s but got %s", signatureUri, expected, strings.Join(names, ","))
+				}
+				return nil
+			},
+		}
+
+		var sigCreator container.SignatureCreatorMock
+		signer := container.NewSigner(sigCreator, archiveService)
+
+		// Act
+		err := signer.RemoveSignatureStream(bytes.NewReader(nil), 0, ioutil.Discard, 1)
+
+		// Assert
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+}
+
+func TestMigrate_ManifestWithoutIDRenamed(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveWithDuplicatesFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig", "META-INF/manifest01.json", "META-INF/manifest01.json.sig"), nil
+		},
+		CreateArchiveFunc: func(entries []services.ArchiveEntry, w io.Writer) error {
+			if entries[3].Name != "META-INF/manifest2.json" || entries[4].Name != "META-INF/manifest01.json.sig" {
+				t.Errorf("invalid migrated entries %v", entries)
+			}
+			return nil
+		},
+	}
+
+	var sigCreator container.SignatureCreatorMock
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	migrations, err := signer.MigrateStream(bytes.NewReader(nil), 0, ioutil.Discard)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expected := container.SignatureMigration{OldManifestUri: "META-INF/manifest01.json", ManifestUri: "META-INF/manifest2.json", ID: 2}
+	if len(migrations) != 1 || migrations[0] != expected {
+		t.Fatalf("invalid migrations! got=%v, want=%v", migrations, []container.SignatureMigration{expected})
+	}
+}
+
+func TestMigrate_DuplicateManifestsRenumbered(t *testing.T) {
+	manifest := func(files string) string {
+		return `{"files":[` + files + `],"signature_uri":"META-INF/manifest2.json.sig"}`
+	}
+	first := manifest(`{"uri":"text1.txt","hash_algorithm":"SHA256","hash":"` + testFileContentHash + `"}`)
+	second := manifest(``)
+	legacy := testZip(t,
+		testZipEntry{name: "text1.txt", content: "content"},
+		testZipEntry{name: "META-INF/manifest2.json", content: first},
+		testZipEntry{name: "META-INF/manifest2.json.sig", content: "signature of " + first},
+		testZipEntry{name: "META-INF/manifest2.json", content: second},
+		testZipEntry{name: "META-INF/manifest2.json.sig", content: "signature of " + second},
+	)
+
+	archiveService := container.NewZipArchiveService()
+	var sigCreator container.SignatureCreatorMock
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	var migrated bytes.Buffer
+	migrations, err := signer.MigrateStream(bytes.NewReader(legacy), int64(len(legacy)), &migrated)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expected := container.SignatureMigration{
+		OldManifestUri:  "META-INF/manifest2.json",
+		ManifestUri:     "META-INF/manifest3.json",
+		ID:              3,
+		OldSignatureUri: "META-INF/manifest2.json.sig",
+		SignatureUri:    "META-INF/manifest3.json.sig",
+	}
+	if len(migrations) != 1 || migrations[0] != expected {
+		t.Fatalf("invalid migrations! got=%v, want=%v", migrations, []container.SignatureMigration{expected})
+	}
+
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			if string(sig) != "signature of "+string(document) {
+				return services.KSIVerificationResult{}, errors.New("signature of another manifest")
+			}
+			return services.KSIVerificationResult{}, nil
+		},
+	}
+	report, err := container.NewVerifier(ksiVerifier, archiveService).VerifyStream(bytes.NewReader(migrated.Bytes()), int64(migrated.Len()), services.PolicyKeyBased)
+	if err != nil {
+		t.Fatal("failed to read migrated container:", err)
+	}
+	if !report.Valid() || len(report.Signatures) != 2 || report.Signatures[1].SignatureUri != expected.SignatureUri {
+		t.Fatalf("expected migrated signatures to be paired with their manifests: %+v", report)
+	}
+}
+
+func TestMigrate_ReferencedManifestRefused(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveWithDuplicatesFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return []services.ArchiveEntry{
+				testEntry("text1.txt", "text1.txt"),
+				testEntry("META-INF/manifest01.json", `{"signature_uri":"META-INF/manifest01.json.sig"}`),
+				testEntry("META-INF/manifest01.json.sig", "signature"),
+				testEntry("META-INF/manifest2.json", `{"signature_uri":"META-INF/manifest2.json.sig","previous_manifests":[{"uri":"META-INF/manifest01.json"}]}`),
+				testEntry("META-INF/manifest2.json.sig", "signature"),
+			}, nil
+		},
+	}
+
+	var sigCreator container.SignatureCreatorMock
+	signer := container.NewSigner(sigCreator, archiveService)
+
+	// Act
+	_, err := signer.MigrateStream(bytes.NewReader(nil), 0, ioutil.Discard)
+
+	// Assert
+	if !errors.Is(err, container.ErrCannotMigrate) {
+		t.Fatalf("expected error '%s' but received '%v'", container.ErrCannotMigrate, err)
+	}
+}
+
+func TestAddSignatureContext_CancelledWhileSigning(t *testing.T) {
+	dir := t.TempDir()
+	containerPath := filepath.Join(dir, "container.zip")
+	if err := ioutil.WriteFile(containerPath, []byte("original"), 0644); err != nil {
+		t.Fatal("failed to setup test:", err)
+	}
+
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testEntries("text1.txt", "META-INF/manifest1.json", "META-INF/manifest1.json.sig"), nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ksiSigner := services.KSISignerMock{
+		SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+
+	signer := container.NewSigner(container.NewSignatureCreator(ksiSigner), archiveService)
+
+	// Act
+	err := signer.AddSignatureContext(ctx, containerPath)
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error '%s' but received '%v'", context.Canceled, err)
+	}
+
+	if content, _ := ioutil.ReadFile(containerPath); string(content) != "original" {
+		t.Errorf("expected container to be untouched but it has content '%s'", content)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected no temporary files next to container but directory has %v entries", len(files))
+	}
 }
@@ -0,0 +1,286 @@
+package container
+
+import (
+	"fmt"
+	"gt/domain/manifest"
+	"gt/services"
+	"io"
+	"sort"
+	"strings"
+)
+
+// VerificationReport holds verification results of all signatures in container.
+type VerificationReport struct {
+	// Format is detected format of the container.
+	Format Format
+	// Policy is KSI verification policy signatures were verified with.
+	Policy     services.VerificationPolicy
+	Signatures []SignatureReport
+	// Coverage lists every data file in container with signatures which manifests cover it.
+	Coverage []FileCoverage
+	// UnsignedFiles lists data files which are not covered by any manifest.
+	UnsignedFiles []string
+}
+
+// FileCoverage lists signatures covering single data file.
+type FileCoverage struct {
+	Uri          string
+	SignatureIDs []int
+}
+
+// Valid reports whether container has at least one signature, all signatures are valid and
+// every data file is covered by a signature. Data files added after signing are unsigned.
+func (r VerificationReport) Valid() bool {
+	if len(r.Signatures) == 0 || len(r.UnsignedFiles) > 0 {
+		return false
+	}
+
+	for _, s := range r.Signatures {
+		if !s.Valid() {
+			return false
+		}
+	}
+	return true
+}
+
+// InternalOnly reports whether signatures were checked only for internal consistency, without any trust anchor.
+// Such report does not prove that signatures were issued by KSI service.
+func (r VerificationReport) InternalOnly() bool {
+	return r.Policy == services.PolicyInternal
+}
+
+// SignatureReport holds verification result of single manifest and its KSI signature.
+type SignatureReport struct {
+	// ID is stable id of the signature, 0 when manifest has none and container has to be migrated.
+	ID           int
+	ManifestUri  string
+	SignatureUri string
+	// Err is set when manifest can not be read or KSI signature verification fails.
+	Err error
+	// KSIResult describes which verification policy was applied and its outcome.
+	KSIResult services.KSIVerificationResult
+	Files     []DataFileReport
+	// PreviousManifests holds check results of manifests which manifest refers to in previous_manifests.
+	PreviousManifests []ManifestReferenceReport
+}
+
+// Valid reports whether signature and all files covered by its manifest are valid.
+func (r SignatureReport) Valid() bool {
+	if r.Err != nil {
+		return false
+	}
+
+	for _, f := range r.Files {
+		if f.Err != nil {
+			return false
+		}
+	}
+	for _, m := range r.PreviousManifests {
+		if m.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ManifestReferenceReport holds check result of single manifest listed in previous_manifests.
+type ManifestReferenceReport struct {
+	Uri string
+	// Missing is set when referenced manifest is no longer in container, e.g. its signature was removed.
+	// Missing manifest does not make signature invalid.
+	Missing bool
+	// Err is set when referenced manifest was changed or can not be hashed.
+	Err error
+}
+
+// DataFileReport holds verification result of single data file listed in manifest.
+type DataFileReport struct {
+	Uri           string
+	HashAlgorithm string
+	// DeprecatedHashAlgorithm is set when data file is hashed with algorithm which is no longer trusted.
+	DeprecatedHashAlgorithm bool
+	Err                     error
+}
+
+type Verifier struct {
+	ksiVerifier    services.KSIVerifier
+	archiveService services.ArchiveService
+}
+
+func NewVerifier(ksiVerifier services.KSIVerifier, archiveService services.ArchiveService) Verifier {
+	return Verifier{
+		ksiVerifier:    ksiVerifier,
+		archiveService: archiveService,
+	}
+}
+
+// Verify verifies every manifest and KSI signature in container using given KSI verification policy.
+// Returned error is set only when container itself can not be processed, verification failures are part of the report.
+func (v Verifier) Verify(containerPath string, policy services.VerificationPolicy) (VerificationReport, error) {
+	var report VerificationReport
+	err := readContainer(containerPath, func(r io.ReaderAt, size int64) error {
+		var err error
+		report, err = v.VerifyStream(r, size, policy)
+		return err
+	})
+	return report, err
+}
+
+// VerifyStream verifies container read from r. See Verify.
+func (v Verifier) VerifyStream(r io.ReaderAt, size int64, policy services.VerificationPolicy) (VerificationReport, error) {
+	entries, err := v.archiveService.ReadArchive(r, size)
+	if err != nil {
+		return VerificationReport{}, err
+	}
+
+	files := make(map[string]services.ArchiveEntry, len(entries))
+	for _, e := range entries {
+		files[e.Name] = e
+	}
+
+	l := detectLayout(entries)
+	report := VerificationReport{Format: l.format(), Policy: policy}
+	for _, e := range entries {
+		id, ok := l.manifestID(e.Name)
+		if !ok && !l.isManifest(e.Name) {
+			continue
+		}
+
+		sigReport := v.verifySignature(id, e, files, l, policy)
+		if !ok && sigReport.Err == nil {
+			sigReport.Err = ErrNoSignatureID
+		}
+		report.Signatures = append(report.Signatures, sigReport)
+	}
+
+	sort.Slice(report.Signatures, func(i, j int) bool {
+		return report.Signatures[i].ID < report.Signatures[j].ID
+	})
+
+	covered := make(map[string][]int)
+	for _, sig := range report.Signatures {
+		for _, f := range sig.Files {
+			covered[f.Uri] = append(covered[f.Uri], sig.ID)
+		}
+	}
+
+	for _, e := range entries {
+		if !l.isDataFile(e.Name) {
+			continue
+		}
+
+		report.Coverage = append(report.Coverage, FileCoverage{Uri: e.Name, SignatureIDs: covered[e.Name]})
+		if len(covered[e.Name]) == 0 {
+			report.UnsignedFiles = append(report.UnsignedFiles, e.Name)
+		}
+	}
+
+	return report, nil
+}
+
+// verifySignature verifies manifest and its signature. Files maps container paths to container entries.
+func (v Verifier) verifySignature(id int, manifestEntry services.ArchiveEntry, files map[string]services.ArchiveEntry, l layout, policy services.VerificationPolicy) SignatureReport {
+	report := SignatureReport{
+		ID:          id,
+		ManifestUri: manifestEntry.Name,
+	}
+
+	manifestBytes, err := readEntry(manifestEntry)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	model, err := l.unmarshalManifest(manifestBytes)
+	if err != nil {
+		report.Err = fmt.Errorf("invalid manifest: %w", err)
+		return report
+	}
+
+	report.SignatureUri = manifestSignatureUri(model, id, l)
+
+	for _, df := range model.Files {
+		file, ok := files[df.Uri]
+		report.Files = append(report.Files, v.verifyDataFile(df, file, ok))
+	}
+
+	for _, ref := range model.PreviousManifests {
+		entry, ok := files[ref.Uri]
+		report.PreviousManifests = append(report.PreviousManifests, v.verifyManifestReference(ref, entry, ok))
+	}
+
+	sigEntry, ok := files[report.SignatureUri]
+	if !ok {
+		report.Err = fmt.Errorf("signature '%s' is missing from container", report.SignatureUri)
+		return report
+	}
+
+	report.KSIResult, report.Err = v.verifyManifestSignature(manifestBytes, sigEntry, policy)
+
+	return report
+}
+
+func (v Verifier) verifyDataFile(df manifest.DataFile, file services.ArchiveEntry, exists bool) DataFileReport {
+	report := DataFileReport{
+		Uri:           df.Uri,
+		HashAlgorithm: df.HashAlgorithm,
+	}
+
+	alg, err := services.ParseHashAlgorithm(df.HashAlgorithm)
+	if err != nil || df.HashAlgorithm == "" {
+		report.Err = fmt.Errorf("%w: %s", ErrUnsupportedHashAlgo, df.HashAlgorithm)
+		return report
+	}
+	report.HashAlgorithm = alg.String()
+	report.DeprecatedHashAlgorithm = !alg.Trusted()
+
+	if !exists {
+		report.Err = fmt.Errorf("%w from container", ErrDataFileMissing)
+		return report
+	}
+
+	digest, _, err := hashEntry(file, alg)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	if digest != strings.ToLower(df.Hash) {
+		report.Err = ErrHashMismatch
+	}
+	return report
+}
+
+func (v Verifier) verifyManifestReference(ref manifest.ManifestReference, entry services.ArchiveEntry, exists bool) ManifestReferenceReport {
+	report := ManifestReferenceReport{Uri: ref.Uri}
+	if !exists {
+		report.Missing = true
+		return report
+	}
+
+	alg, err := services.ParseHashAlgorithm(ref.HashAlgorithm)
+	if err != nil || ref.HashAlgorithm == "" {
+		report.Err = fmt.Errorf("%w: %s", ErrUnsupportedHashAlgo, ref.HashAlgorithm)
+		return report
+	}
+
+	digest, _, err := hashEntry(entry, alg)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	if digest != strings.ToLower(ref.Hash) {
+		report.Err = ErrManifestChanged
+	}
+	return report
+}
+
+func (v Verifier) verifyManifestSignature(manifestBytes []byte, sigEntry services.ArchiveEntry, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+	sig, err := readEntry(sigEntry)
+	if err != nil {
+		return services.KSIVerificationResult{}, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	return v.ksiVerifier.Verify(sig, manifestBytes, policy)
+}
@@ -0,0 +1,504 @@
+package container_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gt/domain/manifest"
+	"gt/services"
+	"gt/services/container"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const (
+	// sha256 of "content"
+	testFileContentHash = "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"
+	testManifest        = `{"files":[{"uri":"text1.txt","hash_algorithm":"SHA256","hash":"` + testFileContentHash + `"}],"signature_uri":"META-INF/manifest1.json.sig"}`
+)
+
+// testContainerFiles returns entries of signed container which data file has given content.
+func testContainerFiles(content string) []services.ArchiveEntry {
+	return []services.ArchiveEntry{
+		testEntry("text1.txt", content),
+		testEntry("META-INF/manifest1.json", testManifest),
+		testEntry("META-INF/manifest1.json.sig", "signature"),
+	}
+}
+
+func TestVerify_ReadArchiveFails(t *testing.T) {
+	expectedErr := errors.New("failed to read archive")
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return nil, expectedErr
+		},
+	}
+
+	var ksiVerifier services.KSIVerifierMock
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	_, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != expectedErr {
+		t.Fatalf("expected error '%s' but received '%s'", expectedErr, err)
+	}
+}
+
+func TestVerify_ValidContainer(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+	}
+
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			if string(sig) != "signature" {
+				t.Errorf("invalid signature passed to ksi verifier! got=%s", sig)
+			}
+
+			if policy != services.PolicyInternal {
+				t.Errorf("invalid policy passed to ksi verifier! got=%v, want=%v", policy, services.PolicyInternal)
+			}
+			return services.KSIVerificationResult{Policy: "InternalVerificationPolicy", Code: "OK"}, nil
+		},
+	}
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !report.Valid() {
+		t.Fatalf("expected container to be valid: %+v", report)
+	}
+
+	if !report.InternalOnly() {
+		t.Fatal("expected report of internal policy to be internal only")
+	}
+
+	if len(report.Signatures) != 1 || report.Signatures[0].ID != 1 {
+		t.Fatalf("invalid signatures in report: %+v", report.Signatures)
+	}
+}
+
+func TestVerify_DataFileModified(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("modified content"), nil
+		},
+	}
+
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			return services.KSIVerificationResult{}, nil
+		},
+	}
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if report.Valid() {
+		t.Fatal("expected container to be invalid")
+	}
+
+	if fileErr := report.Signatures[0].Files[0].Err; !errors.Is(fileErr, container.ErrHashMismatch) {
+		t.Fatalf("expected error '%s' but received '%s'", container.ErrHashMismatch, fileErr)
+	}
+}
+
+func TestVerify_KSIVerificationFails(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return testContainerFiles("content"), nil
+		},
+	}
+
+	expectedErr := errors.New("ksi verification failure")
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			return services.KSIVerificationResult{Code: "FAIL"}, expectedErr
+		},
+	}
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if report.Valid() {
+		t.Fatal("expected container to be invalid")
+	}
+
+	if sigErr := report.Signatures[0].Err; sigErr != expectedErr {
+		t.Fatalf("expected error '%s' but received '%s'", expectedErr, sigErr)
+	}
+}
+
+func TestVerify_CoverageReported(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			manifest2 := `{"files":[{"uri":"text2.txt","hash_algorithm":"SHA256","hash":"` + testFileContentHash + `"}],"signature_uri":"META-INF/manifest2.json.sig"}`
+			return append(testContainerFiles("content"),
+				testEntry("text2.txt", "content"),
+				testEntry("text3.txt", "content"),
+				testEntry("META-INF/manifest2.json", manifest2),
+				testEntry("META-INF/manifest2.json.sig", "signature"),
+			), nil
+		},
+	}
+
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			return services.KSIVerificationResult{}, nil
+		},
+	}
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expected := []container.FileCoverage{
+		{Uri: "text1.txt", SignatureIDs: []int{1}},
+		{Uri: "text2.txt", SignatureIDs: []int{2}},
+		{Uri: "text3.txt"},
+	}
+	if !reflect.DeepEqual(report.Coverage, expected) {
+		t.Fatalf("invalid coverage! got=%+v, want=%+v", report.Coverage, expected)
+	}
+
+	if len(report.UnsignedFiles) != 1 || report.UnsignedFiles[0] != "text3.txt" {
+		t.Fatalf("invalid unsigned files! got=%v", report.UnsignedFiles)
+	}
+
+	if report.Valid() {
+		t.Fatal("expected container with unsigned file to be invalid")
+	}
+}
+
+func TestVerify_PreviousManifestsChecked(t *testing.T) {
+	digest := sha256.Sum256([]byte(testManifest))
+	manifest2 := `{"files":[{"uri":"text1.txt","hash_algorithm":"SHA256","hash":"` + testFileContentHash + `"}],` +
+		`"signature_uri":"META-INF/manifest2.json.sig",` +
+		`"previous_manifests":[{"uri":"META-INF/manifest1.json","hash_algorithm":"SHA-256","hash":"` + hex.EncodeToString(digest[:]) + `"}]}`
+
+	tests := []struct {
+		name            string
+		manifest1       string
+		expectedMissing bool
+		expectedErr     error
+	}{
+		{name: "unchanged", manifest1: testManifest},
+		{name: "changed", manifest1: testManifest + " ", expectedErr: container.ErrManifestChanged},
+		{name: "removed", expectedMissing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveService := services.ArchiveServiceMock{
+				ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+					entries := []services.ArchiveEntry{
+						testEntry("text1.txt", "content"),
+						testEntry("META-INF/manifest2.json", manifest2),
+						testEntry("META-INF/manifest2.json.sig", "signature"),
+					}
+					if tt.manifest1 != "" {
+						entries = append(entries,
+							testEntry("META-INF/manifest1.json", tt.manifest1),
+							testEntry("META-INF/manifest1.json.sig", "signature"),
+						)
+					}
+					return entries, nil
+				},
+			}
+
+			ksiVerifier := services.KSIVerifierMock{
+				VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+					return services.KSIVerificationResult{}, nil
+				},
+			}
+
+			verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+			// Act
+			report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyKeyBased)
+
+			// Assert
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			sig := report.Signatures[len(report.Signatures)-1]
+			if sig.ID != 2 || len(sig.PreviousManifests) != 1 {
+				t.Fatalf("expected previous manifest of signature 2 to be reported: %+v", sig)
+			}
+			ref := sig.PreviousManifests[0]
+			if ref.Missing != tt.expectedMissing || !errors.Is(ref.Err, tt.expectedErr) || (tt.expectedErr == nil && ref.Err != nil) {
+				t.Fatalf("invalid previous manifest report: %+v", ref)
+			}
+			if report.Valid() != (tt.expectedErr == nil) {
+				t.Fatalf("expected valid=%v, got %+v", tt.expectedErr == nil, report)
+			}
+		})
+	}
+}
+
+func TestVerify_ASiCEContainerDetected(t *testing.T) {
+	asicManifest := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<asic:ASiCManifest xmlns:asic="http://uri.etsi.org/02918/v1.2.1#" xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+ <asic:SigReference URI="META-INF/timestamp1.tst" MimeType="application/vnd.etsi.timestamp-token"/>
+ <asic:DataObjectReference URI="text1.txt">
+  <ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>
+  <ds:DigestValue>7XACtDnprIRfIjV9giusFERzD722AW0+yUMil7nsn3M=</ds:DigestValue>
+ </asic:DataObjectReference>
+</asic:ASiCManifest>`
+
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			mimetype := testEntry("mimetype", "application/vnd.etsi.asic-e+zip")
+			mimetype.Uncompressed = true
+			return []services.ArchiveEntry{
+				mimetype,
+				testEntry("text1.txt", "content"),
+				testEntry("META-INF/ASiCManifest1.xml", asicManifest),
+				testEntry("META-INF/timestamp1.tst", "signature"),
+			}, nil
+		},
+	}
+
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			if string(sig) != "signature" {
+				t.Errorf("invalid signature passed to ksi verifier! got=%s", sig)
+			}
+			return services.KSIVerificationResult{}, nil
+		},
+	}
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if report.Format != container.FormatASiCE {
+		t.Errorf("invalid format! got=%v, want=%v", report.Format, container.FormatASiCE)
+	}
+
+	if !report.Valid() || len(report.Signatures) != 1 || report.Signatures[0].ID != 1 {
+		t.Fatalf("expected container to be valid: %+v", report)
+	}
+
+	if len(report.UnsignedFiles) != 0 {
+		t.Fatalf("unexpected unsigned files: %v", report.UnsignedFiles)
+	}
+}
+
+func TestVerify_MimetypeDataFileInJSONContainer(t *testing.T) {
+	stored := testEntry("mimetype", "application/vnd.etsi.asic-e+zip")
+	stored.Uncompressed = true
+	tests := []struct {
+		name    string
+		entries []services.ArchiveEntry
+	}{
+		{name: "not first", entries: append(testContainerFiles("content"), stored)},
+		{name: "compressed", entries: append([]services.ArchiveEntry{testEntry("mimetype", "application/vnd.etsi.asic-e+zip")}, testContainerFiles("content")...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveService := services.ArchiveServiceMock{
+				ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+					return tt.entries, nil
+				},
+			}
+			ksiVerifier := services.KSIVerifierMock{
+				VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+					return services.KSIVerificationResult{}, nil
+				},
+			}
+
+			verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+			// Act
+			report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+			// Assert
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if report.Format != container.FormatJSON {
+				t.Errorf("invalid format! got=%v, want=%v", report.Format, container.FormatJSON)
+			}
+			if len(report.UnsignedFiles) != 1 || report.UnsignedFiles[0] != "mimetype" {
+				t.Errorf("expected mimetype to be unsigned data file, got %v", report.UnsignedFiles)
+			}
+		})
+	}
+}
+
+func TestVerify_DataFileHashAlgorithms(t *testing.T) {
+	manifestWith := func(alg, digest string) string {
+		return `{"files":[{"uri":"text1.txt","hash_algorithm":"` + alg + `","hash":"` + digest + `"}],"signature_uri":"META-INF/manifest1.json.sig"}`
+	}
+
+	tests := []struct {
+		name           string
+		manifest       string
+		expectedAlg    string
+		expectedErr    error
+		wantDeprecated bool
+	}{
+		{
+			name:        "sha512",
+			manifest:    manifestWith("SHA-512", "b2d1d285b5199c85f988d03649c37e44fd3dde01e5d69c50fef90651962f48110e9340b60d49a479c4c0b53f5f07d690686dd87d2481937a512e8b85ee7c617f"),
+			expectedAlg: "SHA-512",
+		},
+		{
+			name:           "deprecated sha1",
+			manifest:       manifestWith("SHA1", "040f06fd774092478d450774f5ba30c5da78acc8"),
+			expectedAlg:    "SHA-1",
+			wantDeprecated: true,
+		},
+		{
+			name:        "unknown algorithm",
+			manifest:    manifestWith("MD5", "9a0364b9e99bb480dd25e1f0284c8555"),
+			expectedAlg: "MD5",
+			expectedErr: container.ErrUnsupportedHashAlgo,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveService := services.ArchiveServiceMock{
+				ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+					return []services.ArchiveEntry{
+						testEntry("text1.txt", "content"),
+						testEntry("META-INF/manifest1.json", tt.manifest),
+						testEntry("META-INF/manifest1.json.sig", "signature"),
+					}, nil
+				},
+			}
+
+			ksiVerifier := services.KSIVerifierMock{
+				VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+					if string(document) != tt.manifest {
+						t.Errorf("invalid document passed to ksi verifier! got=%s", document)
+					}
+					return services.KSIVerificationResult{}, nil
+				},
+			}
+
+			verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+			// Act
+			report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+			// Assert
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			file := report.Signatures[0].Files[0]
+			if !errors.Is(file.Err, tt.expectedErr) || (tt.expectedErr == nil && file.Err != nil) {
+				t.Errorf("expected error '%v' but received '%v'", tt.expectedErr, file.Err)
+			}
+
+			if file.HashAlgorithm != tt.expectedAlg || file.DeprecatedHashAlgorithm != tt.wantDeprecated {
+				t.Errorf("invalid hash algorithm! got=%v (deprecated %v), want=%v (deprecated %v)",
+					file.HashAlgorithm, file.DeprecatedHashAlgorithm, tt.expectedAlg, tt.wantDeprecated)
+			}
+		})
+	}
+}
+
+func TestVerify_ManifestWithoutIDReported(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return []services.ArchiveEntry{
+				testEntry("text1.txt", "content"),
+				testEntry("META-INF/manifest.json", testManifest),
+				testEntry("META-INF/manifest1.json.sig", "signature"),
+			}, nil
+		},
+	}
+
+	ksiVerifier := services.KSIVerifierMock{
+		VerifyFunc: func(sig []byte, document []byte, policy services.VerificationPolicy) (services.KSIVerificationResult, error) {
+			return services.KSIVerificationResult{}, nil
+		},
+	}
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(report.Signatures) != 1 || !errors.Is(report.Signatures[0].Err, container.ErrNoSignatureID) {
+		t.Fatalf("expected manifest without id to be reported with error '%s' but got %+v", container.ErrNoSignatureID, report.Signatures)
+	}
+}
+
+func TestVerify_NonCanonicalManifestRejected(t *testing.T) {
+	archiveService := services.ArchiveServiceMock{
+		ReadArchiveFunc: func(r io.ReaderAt, size int64) ([]services.ArchiveEntry, error) {
+			return []services.ArchiveEntry{
+				testEntry("text1.txt", "content"),
+				testEntry("META-INF/manifest1.json", "{\n \"version\": \"1.1\",\n \"files\": [],\n \"signature_uri\": \"META-INF/manifest1.json.sig\"\n}"),
+				testEntry("META-INF/manifest1.json.sig", "signature"),
+			}, nil
+		},
+	}
+
+	var ksiVerifier services.KSIVerifierMock
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.VerifyStream(bytes.NewReader(nil), 0, services.PolicyInternal)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(report.Signatures) != 1 || !errors.Is(report.Signatures[0].Err, manifest.ErrNotCanonical) {
+		t.Fatalf("expected error '%s' but got %+v", manifest.ErrNotCanonical, report.Signatures)
+	}
+}
@@ -0,0 +1,203 @@
+package container_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"gt/services"
+	"gt/services/container"
+	"gt/services/ksitest"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// offlineServices returns signature creator and verifier which work without network: signatures are
+// created by in-process fake aggregator and verified against its trust anchor.
+func offlineServices(t *testing.T) (container.SignatureCreator, services.KSIVerifier, *ksitest.Aggregator) {
+	aggregator, err := ksitest.NewAggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ksiSigner, err := ksitest.NewSigner(aggregator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubFile, err := aggregator.PublicationsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubFilePath := filepath.Join(t.TempDir(), "publications.bin")
+	if err := ioutil.WriteFile(pubFilePath, pubFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ksiVerifier, err := services.NewKSIVerifier(services.KSIVerifierConfig{
+		PublicationsFilePath:     pubFilePath,
+		PublicationsCertEmail:    ksitest.TrustAnchorEmail,
+		PublicationsTrustedCerts: []*x509.Certificate{aggregator.TrustAnchor()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return container.NewSignatureCreator(ksiSigner), ksiVerifier, aggregator
+}
+
+// offlineDataFiles writes data files into temporary directory and returns their paths.
+func offlineDataFiles(t *testing.T, names ...string) []string {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("content of "+name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestEndToEnd_CreateAddSignatureVerify(t *testing.T) {
+	for _, format := range []container.Format{container.FormatJSON, container.FormatASiCE} {
+		t.Run(string(format), func(t *testing.T) {
+			sigCreator, ksiVerifier, _ := offlineServices(t)
+			archiveService := container.NewZipArchiveService()
+			containerPath := filepath.Join(t.TempDir(), "container.zip")
+
+			creator := container.NewCreator(sigCreator, archiveService, container.CreatorOptFormat(format))
+			signer := container.NewSigner(sigCreator, archiveService)
+			verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+			// Act
+			if err := creator.Create(offlineDataFiles(t, "file1.txt", "file2.txt"), containerPath); err != nil {
+				t.Fatalf("failed to create container: %v", err)
+			}
+			if err := signer.AddSignature(containerPath); err != nil {
+				t.Fatalf("failed to add signature: %v", err)
+			}
+			report, err := verifier.Verify(containerPath, services.PolicyKeyBased)
+
+			// Assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Valid() || len(report.Signatures) != 2 {
+				t.Fatalf("expected 2 valid signatures, got %+v", report.Signatures)
+			}
+			if report.Format != format {
+				t.Fatalf("expected format %s, got %s", format, report.Format)
+			}
+			for _, s := range report.Signatures {
+				if s.KSIResult.Policy != "KeyBasedVerificationPolicy" || s.KSIResult.Code != "OK" {
+					t.Fatalf("signature %d: expected key-based verification to pass, got %+v", s.ID, s.KSIResult)
+				}
+			}
+		})
+	}
+}
+
+func TestEndToEnd_ChangedDataFileFailsVerification(t *testing.T) {
+	sigCreator, ksiVerifier, _ := offlineServices(t)
+	archiveService := container.NewZipArchiveService()
+	containerPath := filepath.Join(t.TempDir(), "container.zip")
+
+	creator := container.NewCreator(sigCreator, archiveService)
+	if err := creator.Create(offlineDataFiles(t, "file1.txt"), containerPath); err != nil {
+		t.Fatal(err)
+	}
+	replaceEntry(t, containerPath, "file1.txt", "changed")
+
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	report, err := verifier.Verify(containerPath, services.PolicyKeyBased)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() || report.Signatures[0].Files[0].Err == nil {
+		t.Fatalf("expected changed data file to fail verification, got %+v", report.Signatures)
+	}
+}
+
+// replaceEntry rewrites zip archive with new content of named entry.
+func replaceEntry(t *testing.T, path, name, content string) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		fw, err := w.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name == name {
+			_, err = fw.Write([]byte(content))
+		} else {
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err == nil {
+				_, err = io.Copy(fw, rc)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndToEnd_BatchSignedWithSingleRequest(t *testing.T) {
+	sigCreator, ksiVerifier, aggregator := offlineServices(t)
+	archiveService := container.NewZipArchiveService()
+	dir := t.TempDir()
+
+	creator := container.NewCreator(sigCreator, archiveService)
+	var containers []string
+	for _, name := range []string{"a.zip", "b.zip", "c.zip"} {
+		path := filepath.Join(dir, name)
+		if err := creator.Create(offlineDataFiles(t, "file.txt"), path); err != nil {
+			t.Fatal(err)
+		}
+		containers = append(containers, path)
+	}
+	requests := aggregator.Requests()
+
+	signer := container.NewSigner(sigCreator, archiveService)
+	verifier := container.NewVerifier(ksiVerifier, archiveService)
+
+	// Act
+	results, err := signer.AddSignatureBatch(context.Background(), containers)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := aggregator.Requests() - requests; n != 1 {
+		t.Fatalf("expected single request to aggregator, got %v", n)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.ContainerPath, r.Err)
+		}
+		report, err := verifier.Verify(r.ContainerPath, services.PolicyKeyBased)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Valid() || len(report.Signatures) != 2 {
+			t.Fatalf("%s: expected 2 valid signatures, got %+v", r.ContainerPath, report.Signatures)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package container
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"gt/services"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+)
+
+// NewDataFile returns data file entry which reads its content from r.
+// Name is slash separated path of the file inside container.
+func NewDataFile(name string, r io.ReaderAt, size int64) services.ArchiveEntry {
+	return services.ArchiveEntry{
+		Name:     name,
+		Modified: time.Now(),
+		Open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(io.NewSectionReader(r, 0, size)), nil
+		},
+	}
+}
+
+// collectDataFiles maps given files and directories to container entries. Directories are added recursively.
+// Relative paths keep their directory structure inside container, absolute paths and paths pointing outside
+// of working directory are stored under their base name.
+func collectDataFiles(paths []string) ([]services.ArchiveEntry, error) {
+	var entries []services.ArchiveEntry
+	names := make(map[string]string)
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: '%s'", ErrDataFileMissing, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		root := dataFileRoot(p)
+
+		if !info.IsDir() {
+			if err := checkContainerPath(names, root, p); err != nil {
+				return nil, err
+			}
+			entries = append(entries, fileEntry(p, root, info))
+			continue
+		}
+
+		err = filepath.Walk(p, func(fp string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(p, fp)
+			if err != nil {
+				return err
+			}
+
+			name := path.Join(root, filepath.ToSlash(rel))
+			if err := checkContainerPath(names, name, fp); err != nil {
+				return err
+			}
+			entries = append(entries, fileEntry(fp, name, fi))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// validateDataFiles checks that data files can be stored in container of given layout under their names.
+func validateDataFiles(files []services.ArchiveEntry, l layout) error {
+	names := make(map[string]string)
+	for _, f := range files {
+		if err := checkContainerPath(names, f.Name, f.Name); err != nil {
+			return err
+		}
+
+		if !l.isDataFile(f.Name) {
+			return fmt.Errorf("invalid container path '%s' for file '%s'", f.Name, f.Name)
+		}
+	}
+	return nil
+}
+
+// checkContainerPath validates container path of a data file and records it in names.
+// Source describes where the file comes from and is used in error messages.
+func checkContainerPath(names map[string]string, name, source string) error {
+	if name == "" || name == "." || path.IsAbs(name) || name != path.Clean(name) ||
+		name == ".." || strings.HasPrefix(name, "../") || strings.HasPrefix(name, metaInfPathZip) {
+		return fmt.Errorf("invalid container path '%s' for file '%s'", name, source)
+	}
+
+	if other, ok := names[name]; ok {
+		return fmt.Errorf("files '%s' and '%s' have same container path '%s'", other, source, name)
+	}
+	names[name] = source
+	return nil
+}
+
+// dataFileRoot returns slash separated container path for given file or directory.
+func dataFileRoot(p string) string {
+	cleaned := filepath.Clean(p)
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		cleaned = filepath.Base(cleaned)
+	}
+
+	if cleaned == "." {
+		return ""
+	}
+	return filepath.ToSlash(cleaned)
+}
+
+// fileEntry returns container entry which reads its content from file on disk.
+func fileEntry(filePath, name string, info os.FileInfo) services.ArchiveEntry {
+	return services.ArchiveEntry{
+		Name:     name,
+		Modified: info.ModTime(),
+		Open: func() (io.ReadCloser, error) {
+			f, err := os.Open(filePath)
+			if err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+	}
+}
+
+// bytesEntry returns container entry which holds its content in memory.
+func bytesEntry(name string, content []byte) services.ArchiveEntry {
+	return services.ArchiveEntry{
+		Name:     name,
+		Modified: time.Now(),
+		Open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(content)), nil
+		},
+	}
+}
+
+// readEntry reads whole content of container entry.
+func readEntry(entry services.ArchiveEntry) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// hashEntry returns hex encoded digest and size of container entry content.
+func hashEntry(entry services.ArchiveEntry, alg hash.Algorithm) (string, int64, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+
+	hasher, err := alg.New()
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.Copy(hasher, rc)
+	if err != nil {
+		return "", 0, err
+	}
+
+	imprint, err := hasher.Imprint()
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(imprint.Digest()), size, nil
+}
+
+// mimeType guesses MIME type of data file from its extension.
+func mimeType(name string) string {
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+	if err != nil {
+		return defaultMimeType
+	}
+	return mediaType
+}
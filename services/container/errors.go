@@ -0,0 +1,40 @@
+package container
+
+import "errors"
+
+var (
+	ErrDataFileMissing     = errors.New("data file is missing")
+	ErrHashMismatch        = errors.New("data file hash does not match manifest")
+	ErrHashFailed          = errors.New("failed to hash")
+	ErrUnsupportedHashAlgo = errors.New("unsupported hash algorithm")
+	ErrKSISign             = errors.New("KSI signing failed")
+	ErrKSIExtend           = errors.New("KSI extending failed")
+	ErrNoSignatures        = errors.New("container has no signatures")
+	ErrSignatureNotFound   = errors.New("signature not found")
+	ErrNoSignatureID       = errors.New("manifest has no signature id, container has to be migrated")
+	ErrContainerChanged    = errors.New("container was changed while it was signed")
+	ErrCannotMigrate       = errors.New("container can not be migrated")
+	ErrManifestChanged     = errors.New("previous manifest hash does not match manifest")
+)
+
+// kindError classifies error with one of sentinel errors above, errors.Is matches both the kind and the error.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func withKind(kind, err error) error {
+	return kindError{kind: kind, err: err}
+}
+
+func (e kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e kindError) Unwrap() error {
+	return e.err
+}
+
+func (e kindError) Is(target error) bool {
+	return target == e.kind
+}
@@ -0,0 +1,235 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gt/domain/manifest"
+	"gt/services"
+	"path"
+	"strings"
+)
+
+// Format selects how manifests and signatures are laid out in container.
+type Format string
+
+const (
+	// FormatJSON stores JSON manifests and KSI signatures next to them. It is the default format.
+	FormatJSON Format = "json"
+	// FormatASiCE follows ASiC-E (ETSI EN 319 162-1) with ASiCManifest files and KSI signatures as timestamp tokens.
+	FormatASiCE Format = "asice"
+)
+
+// ParseFormat returns container format by its name. Empty name selects FormatJSON.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatASiCE:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown container format '%s', supported formats: %s, %s", name, FormatJSON, FormatASiCE)
+	}
+}
+
+// layout knows names and encoding of container metadata files of a single format.
+type layout interface {
+	format() Format
+	// manifestUri returns container path of manifest with given id.
+	manifestUri(id int) string
+	// signatureUri returns container path of signature of manifest with given id.
+	signatureUri(id int) string
+	// manifestID returns id of manifest, false if name is not a manifest with id.
+	// Ids are positive and name of manifest with id is always manifestUri(id).
+	manifestID(name string) (int, bool)
+	// isManifest reports whether entry is a manifest, including manifests without valid id.
+	isManifest(name string) bool
+	isSignature(name string) bool
+	// signatureID returns id which signature name is derived from, false if name is not signatureUri of any id.
+	signatureID(name string) (int, bool)
+	// isDataFile reports whether entry holds user data rather than container metadata.
+	isDataFile(name string) bool
+	marshalManifest(model manifest.Model) ([]byte, error)
+	unmarshalManifest(b []byte) (manifest.Model, error)
+	// metadataEntries returns entries which container of this format starts with.
+	metadataEntries() []services.ArchiveEntry
+}
+
+func layoutOf(f Format) layout {
+	if f == FormatASiCE {
+		return asicLayout{}
+	}
+	return jsonLayout{}
+}
+
+// manifestSignatureUri returns container path of signature of manifest with given id, 0 for manifests without id.
+// Manifest reference is used only when it names a signature which is not signature of another id, otherwise
+// default signature path of the id is returned. Manifests renumbered by migration keep references to their old id.
+func manifestSignatureUri(model manifest.Model, id int, l layout) string {
+	if id == 0 {
+		return model.SignatureUri
+	}
+	if !l.isSignature(model.SignatureUri) {
+		return l.signatureUri(id)
+	}
+	if sigID, ok := l.signatureID(model.SignatureUri); ok && sigID != id {
+		return l.signatureUri(id)
+	}
+	return model.SignatureUri
+}
+
+// detectLayout returns layout used by container with given entries. Container is ASiC-E only when it starts
+// with uncompressed mimetype entry of ASiC-E, elsewhere entry named mimetype is a data file.
+func detectLayout(entries []services.ArchiveEntry) layout {
+	if len(entries) == 0 || entries[0].Name != asicMimetypeName || !entries[0].Uncompressed {
+		return jsonLayout{}
+	}
+
+	b, err := readEntry(entries[0])
+	if err == nil && string(b) == asicMimetype {
+		return asicLayout{}
+	}
+	return jsonLayout{}
+}
+
+type jsonLayout struct{}
+
+func (jsonLayout) format() Format {
+	return FormatJSON
+}
+
+func (jsonLayout) manifestUri(id int) string {
+	return metaInfPathZip + fmt.Sprintf(manifestFileNamePattern, id)
+}
+
+func (l jsonLayout) signatureUri(id int) string {
+	return fmt.Sprintf(signatureFileNamePattern, l.manifestUri(id))
+}
+
+func (l jsonLayout) manifestID(name string) (int, bool) {
+	var id int
+	if _, err := fmt.Sscanf(name, metaInfPathZip+manifestFileNamePattern, &id); err != nil || id <= 0 || name != l.manifestUri(id) {
+		return 0, false
+	}
+	return id, true
+}
+
+func (jsonLayout) isManifest(name string) bool {
+	return strings.HasPrefix(name, metaInfPathZip) && path.Ext(name) == path.Ext(initialManifestName)
+}
+
+func (jsonLayout) isSignature(name string) bool {
+	return strings.HasPrefix(name, metaInfPathZip) && strings.HasSuffix(name, signatureFileExtension)
+}
+
+func (l jsonLayout) signatureID(name string) (int, bool) {
+	if !strings.HasSuffix(name, signatureFileExtension) {
+		return 0, false
+	}
+	return l.manifestID(strings.TrimSuffix(name, signatureFileExtension))
+}
+
+func (jsonLayout) isDataFile(name string) bool {
+	return !strings.HasPrefix(name, metaInfPathZip)
+}
+
+func (jsonLayout) marshalManifest(model manifest.Model) ([]byte, error) {
+	return model.MarshalCanonical()
+}
+
+func (jsonLayout) unmarshalManifest(b []byte) (manifest.Model, error) {
+	var model manifest.Model
+	if err := json.Unmarshal(b, &model); err != nil {
+		return manifest.Model{}, err
+	}
+
+	if err := model.CheckVersion(); err != nil {
+		return manifest.Model{}, err
+	}
+
+	// Signed bytes of canonical manifests can be derived from their content.
+	if model.RequiresCanonical() {
+		if err := manifest.CheckCanonical(b); err != nil {
+			return manifest.Model{}, err
+		}
+	}
+	return model, nil
+}
+
+func (jsonLayout) metadataEntries() []services.ArchiveEntry {
+	return nil
+}
+
+type asicLayout struct{}
+
+func (asicLayout) format() Format {
+	return FormatASiCE
+}
+
+func (asicLayout) manifestUri(id int) string {
+	return metaInfPathZip + fmt.Sprintf(asicManifestNamePattern, id)
+}
+
+func (asicLayout) signatureUri(id int) string {
+	return metaInfPathZip + fmt.Sprintf(asicTimestampNamePattern, id)
+}
+
+func (l asicLayout) manifestID(name string) (int, bool) {
+	var id int
+	if _, err := fmt.Sscanf(name, metaInfPathZip+asicManifestNamePattern, &id); err != nil || id <= 0 || name != l.manifestUri(id) {
+		return 0, false
+	}
+	return id, true
+}
+
+func (asicLayout) isManifest(name string) bool {
+	return strings.HasPrefix(name, metaInfPathZip+"ASiCManifest") && path.Ext(name) == path.Ext(asicManifestNamePattern)
+}
+
+func (asicLayout) isSignature(name string) bool {
+	return strings.HasPrefix(name, metaInfPathZip) && strings.HasSuffix(name, path.Ext(asicTimestampNamePattern))
+}
+
+func (l asicLayout) signatureID(name string) (int, bool) {
+	var id int
+	if _, err := fmt.Sscanf(name, metaInfPathZip+asicTimestampNamePattern, &id); err != nil || id <= 0 || name != l.signatureUri(id) {
+		return 0, false
+	}
+	return id, true
+}
+
+func (asicLayout) isDataFile(name string) bool {
+	return name != asicMimetypeName && !strings.HasPrefix(name, metaInfPathZip)
+}
+
+func (asicLayout) marshalManifest(model manifest.Model) ([]byte, error) {
+	asic, err := model.Sorted().ASiC()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := xml.MarshalIndent(asic, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (asicLayout) unmarshalManifest(b []byte) (manifest.Model, error) {
+	var asic manifest.ASiCManifest
+	if err := xml.NewDecoder(bytes.NewReader(b)).Decode(&asic); err != nil {
+		return manifest.Model{}, err
+	}
+	model, err := asic.Model()
+	if err != nil {
+		return manifest.Model{}, err
+	}
+	return model, model.CheckVersion()
+}
+
+func (asicLayout) metadataEntries() []services.ArchiveEntry {
+	mimetype := bytesEntry(asicMimetypeName, []byte(asicMimetype))
+	mimetype.Uncompressed = true
+	return []services.ArchiveEntry{mimetype}
+}
@@ -1,148 +1,240 @@
 package container
 
 import (
-	"crypto/sha256"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"gt/domain/manifest"
 	"gt/services"
-	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"time"
 
 	"github.com/guardtime/goksi/hash"
 )
 
 type SignatureCreatorResponse struct {
-	ManifestFilePath  string
-	SignatureFilePath string
+	// ManifestUri is container path of the manifest.
+	ManifestUri string
+	Manifest    []byte
+	// SignatureUri is container path of the KSI signature of the manifest.
+	SignatureUri string
+	Signature    []byte
+}
+
+// archiveEntries returns manifest and signature as container entries.
+func (r SignatureCreatorResponse) archiveEntries() []services.ArchiveEntry {
+	return []services.ArchiveEntry{
+		bytesEntry(r.ManifestUri, r.Manifest),
+		bytesEntry(r.SignatureUri, r.Signature),
+	}
+}
+
+// SignatureParams describes manifest and signature created by SignatureCreator.
+type SignatureParams struct {
+	ID int
+	// Format selects manifest encoding and names of created files.
+	Format Format
+	// DataFileHashAlgorithm is used for data file hashes listed in manifest.
+	DataFileHashAlgorithm hash.Algorithm
+	// ManifestHashAlgorithm is used for manifest hash which is signed with KSI.
+	ManifestHashAlgorithm hash.Algorithm
+	// PreviousManifests are manifests already in container, new manifest refers to them.
+	PreviousManifests []services.ArchiveEntry
 }
 
 type SignatureCreator interface {
-	NewSignature(filePaths []string, manifestName string) (SignatureCreatorResponse, error)
+	// NewSignature creates manifest which lists given data files and signs it.
+	// Hashing and signing stop when ctx is done.
+	NewSignature(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error)
+	// NewManifest creates manifest like NewSignature, but does not sign it. Signature is created with SignManifests.
+	NewManifest(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error)
+	// SignManifests signs manifests of all given responses with single KSI request and sets their signatures.
+	// Manifests are hashed with given algorithm.
+	SignManifests(ctx context.Context, responses []SignatureCreatorResponse, alg hash.Algorithm) error
 }
 
 type signatureCreator struct {
 	ksiSigner services.KSISigner
+	tool      string
+	signer    *manifest.SignerClaims
+	now       func() time.Time
+}
+
+// SignatureCreatorOption configures SignatureCreator.
+type SignatureCreatorOption func(*signatureCreator)
+
+// SignatureCreatorOptTool sets tool identity recorded in manifests. Default is "gt".
+func SignatureCreatorOptTool(tool string) SignatureCreatorOption {
+	return func(sc *signatureCreator) {
+		sc.tool = tool
+	}
+}
+
+// SignatureCreatorOptSignerClaims sets signer claims recorded in manifests. By default manifests have no claims.
+func SignatureCreatorOptSignerClaims(claims manifest.SignerClaims) SignatureCreatorOption {
+	return func(sc *signatureCreator) {
+		if claims != (manifest.SignerClaims{}) {
+			sc.signer = &claims
+		}
+	}
+}
+
+// SignatureCreatorOptClock sets source of manifest creation time. Default is time.Now.
+// Manifests with the same content and creation time are byte-identical.
+func SignatureCreatorOptClock(now func() time.Time) SignatureCreatorOption {
+	return func(sc *signatureCreator) {
+		sc.now = now
+	}
 }
 
-func NewSignatureCreator(ksiSigner services.KSISigner) SignatureCreator {
-	return signatureCreator{
+func NewSignatureCreator(ksiSigner services.KSISigner, opts ...SignatureCreatorOption) SignatureCreator {
+	sc := signatureCreator{
 		ksiSigner: ksiSigner,
+		tool:      defaultTool,
+		now:       time.Now,
 	}
+
+	for _, opt := range opts {
+		opt(&sc)
+	}
+	return sc
 }
 
-func (sc signatureCreator) NewSignature(filePaths []string, manifestName string) (SignatureCreatorResponse, error) {
-	if err := sc.createManifest(filePaths, manifestName); err != nil {
+func (sc signatureCreator) NewSignature(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error) {
+	resp, err := sc.NewManifest(ctx, files, params)
+	if err != nil {
+		return SignatureCreatorResponse{}, err
+	}
+
+	responses := []SignatureCreatorResponse{resp}
+	if err := sc.SignManifests(ctx, responses, params.ManifestHashAlgorithm); err != nil {
 		return SignatureCreatorResponse{}, err
 	}
+	return responses[0], nil
+}
+
+func (sc signatureCreator) NewManifest(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error) {
+	for _, alg := range []hash.Algorithm{params.DataFileHashAlgorithm, params.ManifestHashAlgorithm} {
+		if !alg.Trusted() {
+			return SignatureCreatorResponse{}, fmt.Errorf("%w: %s is deprecated", ErrUnsupportedHashAlgo, alg)
+		}
+	}
 
-	manifestPath := filepath.Join(fullMetaInfPath, manifestName)
+	l := layoutOf(params.Format)
+	manifestUri := l.manifestUri(params.ID)
+	signatureUri := l.signatureUri(params.ID)
 
-	sigPath, err := sc.createSignature(manifestPath)
+	manifestBytes, err := sc.createManifest(ctx, files, signatureUri, params, l)
 	if err != nil {
 		return SignatureCreatorResponse{}, err
 	}
 
 	return SignatureCreatorResponse{
-		ManifestFilePath:  manifestPath,
-		SignatureFilePath: sigPath,
+		ManifestUri:  manifestUri,
+		Manifest:     manifestBytes,
+		SignatureUri: signatureUri,
 	}, nil
 }
 
-func (sc signatureCreator) createManifest(filePaths []string, manifestName string) error {
-	manifestModel := manifest.Model{
-		Files:        make([]manifest.DataFile, 0, len(filePaths)),
-		SignatureUri: fmt.Sprintf("%s%s.sig", metaInfPathZip, manifestName),
-	}
-
-	for _, fp := range filePaths {
-		hash, alg, err := sc.createHash(fp)
+func (sc signatureCreator) SignManifests(ctx context.Context, responses []SignatureCreatorResponse, alg hash.Algorithm) error {
+	hashes := make([]hash.Imprint, 0, len(responses))
+	for _, resp := range responses {
+		h, err := hashManifest(resp.Manifest, alg)
 		if err != nil {
-			return nil
-		}
-
-		dataFile := manifest.DataFile{
-			Uri:           filepath.Base(fp),
-			Hash:          hash,
-			HashAlgorithm: alg,
+			return err
 		}
-
-		manifestModel.Files = append(manifestModel.Files, dataFile)
+		hashes = append(hashes, h)
 	}
 
-	fullPath := filepath.Join(fullMetaInfPath, manifestName)
-	f, err := os.OpenFile(fullPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0777)
+	sigs, err := services.SignBatch(ctx, sc.ksiSigner, hashes)
 	if err != nil {
-		return err
+		return withKind(ErrKSISign, err)
 	}
-	defer f.Close()
 
-	b, err := json.MarshalIndent(manifestModel, "", " ")
-	if err != nil {
-		return err
+	for i, sig := range sigs {
+		b, err := sig.Serialize()
+		if err != nil {
+			return fmt.Errorf("%w: failed to serialize signature: %v", ErrKSISign, err)
+		}
+		responses[i].Signature = b
 	}
-
-	return ioutil.WriteFile(fullPath, b, 0777)
+	return nil
 }
 
-func (sc signatureCreator) createHash(filePath string) (string, string, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return "", "", nil
-	}
-	defer f.Close()
-
-	hasher := sha256.New()
+func (sc signatureCreator) createManifest(ctx context.Context, files []services.ArchiveEntry, signatureUri string, params SignatureParams, l layout) ([]byte, error) {
+	created := sc.now().UTC().Truncate(time.Second)
+	manifestModel := manifest.Model{
+		Version:      manifest.Version,
+		Created:      &created,
+		Tool:         sc.tool,
+		Signer:       sc.signer,
+		Files:        make([]manifest.DataFile, 0, len(files)),
+		SignatureUri: signatureUri,
+	}
+
+	alg := params.DataFileHashAlgorithm
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-	if _, err := io.Copy(hasher, f); err != nil {
-		return "", "", err
-	}
+		digest, size, err := hashEntry(file, alg)
+		if err != nil {
+			return nil, hashError(file.Name, err)
+		}
 
-	return fmt.Sprintf("%x", hasher.Sum(nil)), "SHA256", nil
-}
+		dataFile := manifest.DataFile{
+			Uri:           file.Name,
+			Hash:          digest,
+			HashAlgorithm: alg.String(),
+			Size:          size,
+			MimeType:      mimeType(file.Name),
+		}
 
-func (sc signatureCreator) createSignature(manifestPath string) (string, error) {
-	manifestFile, err := os.Open(manifestPath)
-	if err != nil {
-		return "", err
+		manifestModel.Files = append(manifestModel.Files, dataFile)
 	}
 
-	hsr, err := hash.Default.New()
-	if err != nil {
-		return "", err
-	}
+	for _, m := range params.PreviousManifests {
+		digest, _, err := hashEntry(m, params.ManifestHashAlgorithm)
+		if err != nil {
+			return nil, hashError(m.Name, err)
+		}
 
-	if _, err := io.Copy(hsr, manifestFile); err != nil {
-		return "", err
+		manifestModel.PreviousManifests = append(manifestModel.PreviousManifests, manifest.ManifestReference{
+			Uri:           m.Name,
+			HashAlgorithm: params.ManifestHashAlgorithm.String(),
+			Hash:          digest,
+		})
 	}
 
-	manifestHash, err := hsr.Imprint()
+	b, err := l.marshalManifest(manifestModel)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
 	}
+	return b, nil
+}
 
-	sig, err := sc.ksiSigner.Sign(manifestHash)
-	if err != nil {
-		return "", err
+// hashError wraps error of hashing container entry, files which can not be found are reported as missing.
+func hashError(name string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: '%s': %v", ErrDataFileMissing, name, err)
 	}
+	return fmt.Errorf("%w '%s': %v", ErrHashFailed, name, err)
+}
 
-	bin, err := sig.Serialize()
+func hashManifest(manifestBytes []byte, alg hash.Algorithm) (hash.Imprint, error) {
+	hsr, err := alg.New()
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w manifest: %v", ErrHashFailed, err)
 	}
 
-	sigFileName := fmt.Sprintf(signatureFileFullPathPattern, fullMetaInfPath, filepath.Base(manifestPath))
-	sigFile, err := os.Create(sigFileName)
-	if err != nil {
-		return "", err
+	if _, err := hsr.Write(manifestBytes); err != nil {
+		return nil, fmt.Errorf("%w manifest: %v", ErrHashFailed, err)
 	}
-	defer sigFile.Close()
 
-	if _, err := sigFile.Write(bin); err != nil {
-		return "", err
+	manifestHash, err := hsr.Imprint()
+	if err != nil {
+		return nil, fmt.Errorf("%w manifest: %v", ErrHashFailed, err)
 	}
-
-	return sigFileName, nil
+	return manifestHash, nil
 }
@@ -1,12 +1,35 @@
 package container
 
+import (
+	"context"
+	"gt/services"
+
+	"github.com/guardtime/goksi/hash"
+)
+
 type SignatureCreatorMock struct {
-	NewSignatureFunc func(filePaths []string, manifestName string) (SignatureCreatorResponse, error)
+	NewSignatureFunc  func(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error)
+	NewManifestFunc   func(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error)
+	SignManifestsFunc func(ctx context.Context, responses []SignatureCreatorResponse, alg hash.Algorithm) error
 }
 
-func (m SignatureCreatorMock) NewSignature(filePaths []string, manifestName string) (SignatureCreatorResponse, error) {
+func (m SignatureCreatorMock) NewSignature(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error) {
 	if m.NewSignatureFunc == nil {
 		panic("NewSignatureFunc is uninitialized!")
 	}
-	return m.NewSignatureFunc(filePaths, manifestName)
+	return m.NewSignatureFunc(ctx, files, params)
+}
+
+func (m SignatureCreatorMock) NewManifest(ctx context.Context, files []services.ArchiveEntry, params SignatureParams) (SignatureCreatorResponse, error) {
+	if m.NewManifestFunc == nil {
+		panic("NewManifestFunc is uninitialized!")
+	}
+	return m.NewManifestFunc(ctx, files, params)
+}
+
+func (m SignatureCreatorMock) SignManifests(ctx context.Context, responses []SignatureCreatorResponse, alg hash.Algorithm) error {
+	if m.SignManifestsFunc == nil {
+		panic("SignManifestsFunc is uninitialized!")
+	}
+	return m.SignManifestsFunc(ctx, responses, alg)
 }
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/guardtime/goksi/hash"
+	"golang.org/x/crypto/sha3"
+)
+
+func init() {
+	// goksi does not register SHA-3 family by itself.
+	hash.RegisterHash(hash.SHA3_224, sha3.New224)
+	hash.RegisterHash(hash.SHA3_256, sha3.New256)
+	hash.RegisterHash(hash.SHA3_384, sha3.New384)
+	hash.RegisterHash(hash.SHA3_512, sha3.New512)
+}
+
+// ParseHashAlgorithm returns hash algorithm by its name, e.g. "SHA-256", "SHA-512" or "SHA3-256".
+// Empty name selects hash.Default. Algorithms which can not be computed are rejected.
+func ParseHashAlgorithm(name string) (hash.Algorithm, error) {
+	if name == "" {
+		return hash.Default, nil
+	}
+
+	alg, err := hash.ByName(name)
+	if err != nil || !alg.Registered() {
+		return hash.SHA_NA, fmt.Errorf("unsupported hash algorithm '%s'", name)
+	}
+	return alg, nil
+}
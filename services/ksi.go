@@ -1,17 +1,130 @@
 package services
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/guardtime/goksi/errors"
 	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/net"
 	"github.com/guardtime/goksi/service"
 	"github.com/guardtime/goksi/signature"
 )
 
 // KSISigner is helper interface to wrap guardtime Signer struct.
 type KSISigner interface {
-	Sign(hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error)
+	// Sign signs hash, request is abandoned when ctx is done.
+	Sign(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error)
+}
+
+type ksiSigner struct {
+	signer   *service.Signer
+	password string
+	timeout  time.Duration
+}
+
+// KSISignerOption configures signer created by NewKSISigner.
+type KSISignerOption func(*ksiSigner)
+
+// KSISignerOptTimeout limits duration of single signing request. By default only guardtime API
+// limits it. Request which times out fails with ErrKSITransient.
+func KSISignerOptTimeout(timeout time.Duration) KSISignerOption {
+	return func(s *ksiSigner) {
+		s.timeout = timeout
+	}
 }
 
 // NewKSISigner creates Signer service, uses guardtime API underneath.
-func NewKSISigner(endpoint, username, pswd string) (KSISigner, error) {
-	return service.NewSigner(service.OptEndpoint(endpoint, username, pswd))
+// Password is read from provider once, it is never included in returned errors.
+func NewKSISigner(endpoint, username string, password SecretProvider, opts ...KSISignerOption) (KSISigner, error) {
+	pswd, err := password.Secret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signer password: %w", err)
+	}
+
+	signer, err := service.NewSigner(service.OptEndpoint(endpoint, username, pswd))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer configuration: %s", Redact(ksiErrorMessage(err), pswd))
+	}
+
+	s := ksiSigner{signer: signer, password: pswd}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s, nil
+}
+
+// NewKSISignerWithClient creates signer which sends requests through client, e.g. in-process aggregator of tests.
+func NewKSISignerWithClient(client net.Client, opts ...KSISignerOption) (KSISigner, error) {
+	signer, err := service.NewSigner(service.OptNetClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer configuration: %s", ksiErrorMessage(err))
+	}
+
+	s := ksiSigner{signer: signer}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s, nil
+}
+
+// Sign signs hash, returned errors do not carry stack traces of guardtime errors.
+// Errors which may go away on retry are marked with ErrKSITransient, cancellation of ctx is returned as ctx error.
+func (s ksiSigner) Sign(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+	reqCtx := ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	// Options are copied, appending to opt could overwrite backing array of the caller.
+	opts := make([]service.SignOption, 0, len(opt)+1)
+	opts = append(append(opts, opt...), service.SignOptionWithContext(reqCtx))
+	sig, err := s.signer.Sign(hash, opts...)
+	if err == nil {
+		return sig, nil
+	}
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("failed to sign: %w", ctx.Err())
+	}
+	msg := Redact(ksiErrorMessage(err), s.password)
+	if reqCtx.Err() != nil {
+		msg = fmt.Sprintf("request timed out after %s: %s", s.timeout, msg)
+		return nil, &ksiError{msg: "failed to sign: " + msg, transient: true}
+	}
+	return nil, &ksiError{msg: "failed to sign: " + msg, transient: isTransientKSIError(err)}
+}
+
+// isTransientKSIError reports whether guardtime error is caused by network or by temporary state of the service.
+func isTransientKSIError(err error) bool {
+	switch errors.KsiErr(err).Code() {
+	case errors.KsiNetworkError,
+		errors.KsiHttpError,
+		errors.KsiIoError,
+		errors.KsiServiceInternalError,
+		errors.KsiServiceUpstreamError,
+		errors.KsiServiceUpstreamTimeout,
+		errors.KsiServiceAggrTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// ksiErrorMessage returns guardtime error description without stack trace it carries.
+func ksiErrorMessage(err error) string {
+	ksiErr := errors.KsiErr(err)
+
+	msgs := []string{ksiErr.Code().String()}
+	for i := len(ksiErr.Message()); i > 0; i-- {
+		msgs = append(msgs, ksiErr.Message()[i-1])
+	}
+
+	if ksiErr.ExtError() != nil {
+		msgs = append(msgs, ksiErr.ExtError().Error())
+	}
+	return strings.Join(msgs, ": ")
 }
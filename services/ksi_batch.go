@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/pdu"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+	"github.com/guardtime/goksi/treebuilder"
+)
+
+// SignBatch signs every hash with single request to signer. Hashes are aggregated into local hash tree,
+// its root is signed and signature of every hash is derived from the root signature by prepending
+// aggregation chain from the hash to the root. Signatures are returned in order of hashes.
+func SignBatch(ctx context.Context, signer KSISigner, hashes []hash.Imprint) ([]*signature.Signature, error) {
+	switch len(hashes) {
+	case 0:
+		return nil, nil
+	case 1:
+		sig, err := signer.Sign(ctx, hashes[0])
+		if err != nil {
+			return nil, err
+		}
+		return []*signature.Signature{sig}, nil
+	}
+
+	tree, err := treebuilder.New(
+		treebuilder.TreeOptAlgorithm(hashes[0].Algorithm()),
+		treebuilder.TreeOptMaxLevel(pdu.TreeMaxLevel),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aggregation tree: %s", ksiErrorMessage(err))
+	}
+	for _, h := range hashes {
+		if err := tree.AddNode(h); err != nil {
+			return nil, fmt.Errorf("failed to add hash to aggregation tree: %s", ksiErrorMessage(err))
+		}
+	}
+
+	root, level, err := tree.Aggregate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate hashes: %s", ksiErrorMessage(err))
+	}
+
+	rootSig, err := signer.Sign(ctx, root, service.SignOptionLevel(level))
+	if err != nil {
+		return nil, err
+	}
+
+	leafs, err := tree.Leafs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read aggregation tree: %s", ksiErrorMessage(err))
+	}
+	sigs := make([]*signature.Signature, 0, len(leafs))
+	for i, leaf := range leafs {
+		sig, err := leafSignature(rootSig, leaf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive signature of hash %d: %w", i, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// leafSignature derives signature of tree leaf from signature of tree root.
+func leafSignature(rootSig *signature.Signature, leaf *treebuilder.TreeNode) (*signature.Signature, error) {
+	chain, err := leaf.AggregationChain()
+	if err != nil {
+		return nil, errors.New(ksiErrorMessage(err))
+	}
+
+	sig, err := signature.New(signature.BuildWithAggrChain(rootSig, chain))
+	if err != nil {
+		return nil, errors.New(ksiErrorMessage(err))
+	}
+	return sig, nil
+}
@@ -0,0 +1,108 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gt/services"
+	"gt/services/ksitest"
+	"testing"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
+// fakeKSISigner returns signer of in-process fake aggregator.
+func fakeKSISigner(t *testing.T) services.KSISigner {
+	aggregator, err := ksitest.NewAggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ksitest.NewSigner(aggregator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func testHashes(n int) []hash.Imprint {
+	hashes := make([]hash.Imprint, n)
+	for i := range hashes {
+		hashes[i] = append(hash.Imprint{byte(hash.SHA2_256)}, bytes.Repeat([]byte{byte(i + 1)}, hash.SHA2_256.Size())...)
+	}
+	return hashes
+}
+
+func TestSignBatch_SignatureOfEveryHashDerivedFromSingleRequest(t *testing.T) {
+	var calls int
+	fake := fakeKSISigner(t)
+	signer := services.KSISignerMock{
+		SignFunc: func(ctx context.Context, root hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			calls++
+			return fake.Sign(ctx, root, opt...)
+		},
+	}
+	hashes := testHashes(5)
+
+	// Act
+	sigs, err := services.SignBatch(context.Background(), signer, hashes)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected single signing request, got %v", calls)
+	}
+	if len(sigs) != len(hashes) {
+		t.Fatalf("expected %v signatures, got %v", len(hashes), len(sigs))
+	}
+	for i, sig := range sigs {
+		documentHash, err := sig.DocumentHash()
+		if err != nil || !hash.Equal(documentHash, hashes[i]) {
+			t.Fatalf("signature %d: expected document hash %s, got %s, %v", i, hashes[i], documentHash, err)
+		}
+		if err := sig.Verify(signature.InternalVerificationPolicy); err != nil {
+			t.Fatalf("signature %d: %v", i, err)
+		}
+	}
+}
+
+func TestSignBatch_SingleHashSignedDirectly(t *testing.T) {
+	hashes := testHashes(1)
+	fake := fakeKSISigner(t)
+	signer := services.KSISignerMock{
+		SignFunc: func(ctx context.Context, root hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			if !hash.Equal(root, hashes[0]) {
+				t.Fatalf("expected hash to be signed directly, got %s", root)
+			}
+			return fake.Sign(ctx, root, opt...)
+		},
+	}
+
+	// Act
+	sigs, err := services.SignBatch(context.Background(), signer, hashes)
+
+	// Assert
+	if err != nil || len(sigs) != 1 {
+		t.Fatalf("expected single signature, got %v, %v", len(sigs), err)
+	}
+}
+
+func TestSignBatch_SigningFails(t *testing.T) {
+	expectedErr := errors.New("aggregator unavailable")
+	signer := services.KSISignerMock{
+		SignFunc: func(ctx context.Context, root hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			return nil, expectedErr
+		},
+	}
+
+	// Act
+	_, err := services.SignBatch(context.Background(), signer, testHashes(3))
+
+	// Assert
+	if err != expectedErr {
+		t.Fatalf("expected error '%s', got %v", expectedErr, err)
+	}
+}
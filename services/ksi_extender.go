@@ -0,0 +1,87 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/guardtime/goksi/publications"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
+// KSIExtender is helper interface to wrap guardtime Extender struct.
+type KSIExtender interface {
+	// Extend extends serialized signature to the publication at pubTime, or to the nearest publication
+	// in publications file when pubTime is zero. Returns serialized extended signature.
+	// Request is abandoned when ctx is done.
+	Extend(ctx context.Context, sig []byte, pubTime time.Time) ([]byte, error)
+}
+
+type ksiExtender struct {
+	extender *service.Extender
+	password string
+}
+
+// NewKSIExtender creates Extender service, uses guardtime API underneath.
+// Publications file is used to find the nearest publication, it is read from publicationsFilePath on disk
+// or downloaded from publicationsFileURL, path takes precedence. Both can be left empty when
+// signatures are always extended to explicit publication time.
+// Password is read from provider once, it is never included in returned errors.
+func NewKSIExtender(endpoint, username string, password SecretProvider, publicationsFileURL, publicationsFilePath string) (KSIExtender, error) {
+	var pubFileHandler *publications.FileHandler
+	switch {
+	case publicationsFilePath != "":
+		pubFile, err := publications.NewFile(publications.FileFromFile(publicationsFilePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load publications file: %s", ksiErrorMessage(err))
+		}
+		h, err := publications.NewFileHandler(publications.FileHandlerSetFile(pubFile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid publications file configuration: %s", ksiErrorMessage(err))
+		}
+		pubFileHandler = h
+	case publicationsFileURL != "":
+		h, err := publications.NewFileHandler(publications.FileHandlerSetPublicationsURL(publicationsFileURL))
+		if err != nil {
+			return nil, fmt.Errorf("invalid publications file configuration: %s", ksiErrorMessage(err))
+		}
+		pubFileHandler = h
+	}
+
+	pswd, err := password.Secret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extender password: %w", err)
+	}
+
+	ext, err := service.NewExtender(pubFileHandler, service.OptEndpoint(endpoint, username, pswd))
+	if err != nil {
+		return nil, fmt.Errorf("invalid extender configuration: %s", Redact(ksiErrorMessage(err), pswd))
+	}
+
+	return ksiExtender{extender: ext, password: pswd}, nil
+}
+
+// Extend extends signature, cancellation of ctx is returned as ctx error.
+func (e ksiExtender) Extend(ctx context.Context, sig []byte, pubTime time.Time) ([]byte, error) {
+	ksiSig, err := signature.New(signature.BuildFromStream(bytes.NewReader(sig)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %s", ksiErrorMessage(err))
+	}
+
+	opts := []service.ExtendOption{service.ExtendOptionWithContext(ctx)}
+	if !pubTime.IsZero() {
+		opts = append(opts, service.ExtendOptionToTime(pubTime))
+	}
+
+	extended, err := e.extender.Extend(ksiSig, opts...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to extend signature: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to extend signature: %s", Redact(ksiErrorMessage(err), e.password))
+	}
+
+	return extended.Serialize()
+}
@@ -0,0 +1,45 @@
+package services_test
+
+import (
+	"gt/services"
+	"gt/services/ksitest"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewKSIExtender_LocalPublicationsFileRead(t *testing.T) {
+	aggregator, err := ksitest.NewAggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubFile, err := aggregator.PublicationsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "publications.bin")
+	if err := ioutil.WriteFile(path, pubFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, err = services.NewKSIExtender("http://localhost", "anon", services.StaticSecret("anon"), "", path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewKSIExtender_MissingPublicationsFileRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "publications.bin")
+
+	// Act
+	_, err := services.NewKSIExtender("http://localhost", "anon", services.StaticSecret("anon"), "https://example.com/publications.bin", path)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "failed to load publications file") {
+		t.Fatalf("expected error of missing publications file, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/guardtime/goksi/signature"
+)
+
+// KSISignatureInfo holds metadata of KSI signature.
+type KSISignatureInfo struct {
+	SigningTime time.Time `json:"signing_time"`
+	// HashAlgorithm is algorithm of signed document hash.
+	HashAlgorithm string `json:"hash_algorithm"`
+	// Identity lists client ids found in aggregation hash chains of the signature.
+	Identity []string `json:"identity"`
+	// Extended is set when signature contains publication record.
+	Extended bool `json:"extended"`
+	// PublicationTime and PublicationCode are set only when signature is extended to a publication.
+	PublicationTime *time.Time `json:"publication_time,omitempty"`
+	PublicationCode string     `json:"publication_code,omitempty"`
+}
+
+// KSIInspector reads metadata of KSI signatures without verifying them.
+type KSIInspector interface {
+	Inspect(sig []byte) (KSISignatureInfo, error)
+}
+
+type ksiInspector struct{}
+
+// NewKSIInspector creates KSIInspector, uses guardtime API underneath. No KSI service is needed.
+func NewKSIInspector() KSIInspector {
+	return ksiInspector{}
+}
+
+func (ksiInspector) Inspect(sig []byte) (KSISignatureInfo, error) {
+	ksiSig, err := signature.New(signature.BuildNoVerify(signature.BuildFromStream(bytes.NewReader(sig))))
+	if err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("invalid signature: %s", ksiErrorMessage(err))
+	}
+
+	var info KSISignatureInfo
+	if info.SigningTime, err = ksiSig.SigningTime(); err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read signing time: %s", ksiErrorMessage(err))
+	}
+
+	documentHash, err := ksiSig.DocumentHash()
+	if err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read document hash: %s", ksiErrorMessage(err))
+	}
+	info.HashAlgorithm = documentHash.Algorithm().String()
+
+	identity, err := ksiSig.AggregationHashChainIdentity()
+	if err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read identity: %s", ksiErrorMessage(err))
+	}
+
+	for _, id := range identity {
+		clientID, err := id.ClientID()
+		if err != nil {
+			return KSISignatureInfo{}, fmt.Errorf("failed to read identity: %s", ksiErrorMessage(err))
+		}
+		info.Identity = append(info.Identity, clientID)
+	}
+
+	pubRec, err := ksiSig.Publication()
+	if err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read publication: %s", ksiErrorMessage(err))
+	}
+
+	if pubRec == nil {
+		return info, nil
+	}
+	info.Extended = true
+
+	pubData, err := pubRec.PublicationData()
+	if err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read publication: %s", ksiErrorMessage(err))
+	}
+
+	pubTime, err := pubData.PublicationTime()
+	if err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read publication: %s", ksiErrorMessage(err))
+	}
+	info.PublicationTime = &pubTime
+
+	if info.PublicationCode, err = pubData.Base32(); err != nil {
+		return KSISignatureInfo{}, fmt.Errorf("failed to read publication: %s", ksiErrorMessage(err))
+	}
+
+	return info, nil
+}
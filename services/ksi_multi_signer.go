@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
+// SignerStrategy selects how MultiKSISigner uses its aggregator endpoints.
+type SignerStrategy string
+
+const (
+	// StrategyFailover sends request to endpoints in order until one of them signs.
+	StrategyFailover SignerStrategy = "failover"
+	// StrategyRace sends request to all endpoints at once and takes the first valid signature.
+	StrategyRace SignerStrategy = "race"
+)
+
+const (
+	defaultFailureThreshold = 1
+	defaultRetryAfter       = 30 * time.Second
+)
+
+// ErrAggregatorsUnavailable is returned when every tried aggregator failed to sign.
+var ErrAggregatorsUnavailable = errors.New("no aggregator could sign")
+
+// ParseSignerStrategy returns signer strategy by its name. Empty name selects StrategyFailover.
+func ParseSignerStrategy(name string) (SignerStrategy, error) {
+	switch s := SignerStrategy(name); s {
+	case "":
+		return StrategyFailover, nil
+	case StrategyFailover, StrategyRace:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown signer strategy '%s', supported strategies: %s, %s", name, StrategyFailover, StrategyRace)
+}
+
+// SignerEndpoint is KSI signer of single aggregator endpoint.
+type SignerEndpoint struct {
+	// Name identifies endpoint in errors and health report, e.g. its URL without credentials.
+	Name   string
+	Signer KSISigner
+}
+
+// EndpointHealth describes recent results of single aggregator endpoint.
+type EndpointHealth struct {
+	Name                string
+	Successes           int
+	Failures            int
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	// Healthy is false after too many consecutive failures until retry delay has passed.
+	Healthy bool
+}
+
+// MultiKSISigner signs with several aggregators, so that signing survives outage of some of them.
+// Endpoints which fail repeatedly are tried only after healthy ones, until retry delay has passed.
+type MultiKSISigner struct {
+	endpoints        []SignerEndpoint
+	strategy         SignerStrategy
+	failureThreshold int
+	retryAfter       time.Duration
+	now              func() time.Time
+
+	mu     sync.Mutex
+	health []EndpointHealth
+}
+
+type MultiSignerOption func(*MultiKSISigner)
+
+// MultiSignerOptStrategy selects how endpoints are used. Default is StrategyFailover.
+func MultiSignerOptStrategy(strategy SignerStrategy) MultiSignerOption {
+	return func(s *MultiKSISigner) {
+		s.strategy = strategy
+	}
+}
+
+// MultiSignerOptHealth sets number of consecutive failures after which endpoint is unhealthy and
+// delay after which unhealthy endpoint is tried first again. Defaults are 1 failure and 30 seconds.
+func MultiSignerOptHealth(failureThreshold int, retryAfter time.Duration) MultiSignerOption {
+	return func(s *MultiKSISigner) {
+		s.failureThreshold = failureThreshold
+		s.retryAfter = retryAfter
+	}
+}
+
+// MultiSignerOptClock sets source of current time used for health tracking.
+func MultiSignerOptClock(now func() time.Time) MultiSignerOption {
+	return func(s *MultiKSISigner) {
+		s.now = now
+	}
+}
+
+// NewMultiKSISigner creates signer which uses given endpoints in order of preference.
+func NewMultiKSISigner(endpoints []SignerEndpoint, opts ...MultiSignerOption) (*MultiKSISigner, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("at least one aggregator endpoint is required")
+	}
+
+	s := &MultiKSISigner{
+		endpoints:        endpoints,
+		strategy:         StrategyFailover,
+		failureThreshold: defaultFailureThreshold,
+		retryAfter:       defaultRetryAfter,
+		now:              time.Now,
+		health:           make([]EndpointHealth, len(endpoints)),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if _, err := ParseSignerStrategy(string(s.strategy)); err != nil {
+		return nil, err
+	}
+	for i, e := range endpoints {
+		s.health[i] = EndpointHealth{Name: e.Name, Healthy: true}
+	}
+	return s, nil
+}
+
+// Sign signs hash with the first endpoint which succeeds or, with StrategyRace, which responds first.
+// Error is transient when any endpoint failed with ErrKSITransient.
+func (s *MultiKSISigner) Sign(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+	order, healthy := s.order()
+	if s.strategy == StrategyRace {
+		// Unhealthy endpoints race only when no endpoint is healthy.
+		if healthy > 0 {
+			order = order[:healthy]
+		}
+		return s.race(ctx, order, hash, opt...)
+	}
+
+	var errs []error
+	for _, i := range order {
+		sig, err := s.endpoints[i].Signer.Sign(ctx, hash, opt...)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to sign: %w", ctx.Err())
+		}
+		s.record(i, err)
+		if err == nil {
+			return sig, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s.endpoints[i].Name, err))
+	}
+	return nil, unavailableError(errs)
+}
+
+type signResult struct {
+	endpoint int
+	sig      *signature.Signature
+	err      error
+}
+
+// race sends request to given endpoints at once, requests of slower endpoints are cancelled when
+// the first signature arrives and their results are not recorded in health.
+func (s *MultiKSISigner) race(ctx context.Context, order []int, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan signResult, len(order))
+	for _, i := range order {
+		go func(i int) {
+			sig, err := s.endpoints[i].Signer.Sign(raceCtx, hash, opt...)
+			// Cancelled request says nothing about health of endpoint.
+			if raceCtx.Err() == nil {
+				s.record(i, err)
+			}
+			results <- signResult{endpoint: i, sig: sig, err: err}
+		}(i)
+	}
+
+	errs := make([]error, 0, len(order))
+	for range order {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to sign: %w", ctx.Err())
+		case r := <-results:
+			if r.err == nil {
+				cancel()
+				return r.sig, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", s.endpoints[r.endpoint].Name, r.err))
+		}
+	}
+	return nil, unavailableError(errs)
+}
+
+// unavailableError joins errors of every failed endpoint into ErrAggregatorsUnavailable.
+func unavailableError(errs []error) error {
+	e := &ksiError{kind: ErrAggregatorsUnavailable}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+		e.transient = e.transient || errors.Is(err, ErrKSITransient)
+	}
+	e.msg = fmt.Sprintf("%s: %s", ErrAggregatorsUnavailable, strings.Join(msgs, "; "))
+	return e
+}
+
+// Health returns health of every endpoint in configured order.
+func (s *MultiKSISigner) Health() []EndpointHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := make([]EndpointHealth, len(s.health))
+	for i, h := range s.health {
+		h.Healthy = s.healthy(h)
+		health[i] = h
+	}
+	return health
+}
+
+// order returns indexes of healthy endpoints followed by unhealthy ones, both in configured order,
+// and number of healthy endpoints.
+func (s *MultiKSISigner) order() ([]int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := make([]int, 0, len(s.endpoints))
+	var unhealthy []int
+	for i, h := range s.health {
+		if s.healthy(h) {
+			order = append(order, i)
+		} else {
+			unhealthy = append(unhealthy, i)
+		}
+	}
+	return append(order, unhealthy...), len(order)
+}
+
+func (s *MultiKSISigner) healthy(h EndpointHealth) bool {
+	return h.ConsecutiveFailures < s.failureThreshold || s.now().Sub(h.LastFailure) >= s.retryAfter
+}
+
+func (s *MultiKSISigner) record(i int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := &s.health[i]
+	if err != nil {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+		h.LastFailure = s.now()
+		return
+	}
+	h.Successes++
+	h.ConsecutiveFailures = 0
+	h.LastSuccess = s.now()
+}
@@ -0,0 +1,250 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"gt/services"
+	"gt/services/ksitest"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
+// newFakeAggregator starts in-process aggregator served over HTTP, which answers with HTTP 503 when down.
+func newFakeAggregator(t *testing.T, down bool) (*ksitest.Aggregator, string) {
+	var opts []ksitest.AggregatorOption
+	if down {
+		opts = append(opts, ksitest.AggregatorOptUnavailable())
+	}
+	aggregator, err := ksitest.NewAggregator(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(aggregator)
+	t.Cleanup(server.Close)
+	return aggregator, server.URL
+}
+
+func fakeAggregatorEndpoints(t *testing.T, urls ...string) []services.SignerEndpoint {
+	var endpoints []services.SignerEndpoint
+	for _, url := range urls {
+		signer, err := services.NewKSISigner(url, "anon", services.StaticSecret("anon"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpoints = append(endpoints, services.SignerEndpoint{Name: url, Signer: signer})
+	}
+	return endpoints
+}
+
+func TestMultiKSISigner_FailoverToNextAggregator(t *testing.T) {
+	down, downURL := newFakeAggregator(t, true)
+	up, upURL := newFakeAggregator(t, false)
+	signer, err := services.NewMultiKSISigner(fakeAggregatorEndpoints(t, downURL, upURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	sig, err := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != nil || sig == nil {
+		t.Fatalf("expected signature, got %v", err)
+	}
+	if down.Requests() != 1 || up.Requests() != 1 {
+		t.Fatalf("expected one request to every aggregator, got %v and %v", down.Requests(), up.Requests())
+	}
+
+	health := signer.Health()
+	if health[0].Healthy || health[0].Failures != 1 || health[0].LastError == "" {
+		t.Fatalf("expected failed aggregator to be unhealthy, got %+v", health[0])
+	}
+	if !health[1].Healthy || health[1].Successes != 1 {
+		t.Fatalf("expected aggregator to be healthy, got %+v", health[1])
+	}
+}
+
+func TestMultiKSISigner_RaceTakesFirstValidResponse(t *testing.T) {
+	_, downURL := newFakeAggregator(t, true)
+	up, upURL := newFakeAggregator(t, false)
+	signer, err := services.NewMultiKSISigner(fakeAggregatorEndpoints(t, downURL, upURL),
+		services.MultiSignerOptStrategy(services.StrategyRace),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	sig, err := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != nil || sig == nil {
+		t.Fatalf("expected signature, got %v", err)
+	}
+	if up.Requests() != 1 {
+		t.Fatalf("expected request to aggregator, got %v", up.Requests())
+	}
+}
+
+func TestMultiKSISigner_AllAggregatorsDown(t *testing.T) {
+	for _, strategy := range []services.SignerStrategy{services.StrategyFailover, services.StrategyRace} {
+		t.Run(string(strategy), func(t *testing.T) {
+			_, firstURL := newFakeAggregator(t, true)
+			_, secondURL := newFakeAggregator(t, true)
+			signer, err := services.NewMultiKSISigner(fakeAggregatorEndpoints(t, firstURL, secondURL),
+				services.MultiSignerOptStrategy(strategy),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			_, err = signer.Sign(context.Background(), documentHash)
+
+			// Assert
+			if !errors.Is(err, services.ErrAggregatorsUnavailable) {
+				t.Fatalf("expected ErrAggregatorsUnavailable, got %v", err)
+			}
+			if !errors.Is(err, services.ErrKSITransient) {
+				t.Fatalf("expected unavailable aggregators to be transient error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), firstURL) || !strings.Contains(err.Error(), secondURL) {
+				t.Fatalf("expected error to name every aggregator, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMultiKSISigner_UnhealthyEndpointTriedLast(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var calls []string
+	failing := true
+	endpoint := func(name string, fail *bool) services.SignerEndpoint {
+		return services.SignerEndpoint{Name: name, Signer: services.KSISignerMock{
+			SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+				calls = append(calls, name)
+				if fail != nil && *fail {
+					return nil, errors.New("unavailable")
+				}
+				return &signature.Signature{}, nil
+			},
+		}}
+	}
+
+	signer, err := services.NewMultiKSISigner(
+		[]services.SignerEndpoint{endpoint("primary", &failing), endpoint("secondary", nil)},
+		services.MultiSignerOptHealth(1, time.Minute),
+		services.MultiSignerOptClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, firstErr := signer.Sign(context.Background(), documentHash)
+	_, secondErr := signer.Sign(context.Background(), documentHash)
+	failing = false
+	now = now.Add(time.Minute)
+	_, thirdErr := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if firstErr != nil || secondErr != nil || thirdErr != nil {
+		t.Fatalf("unexpected errors: %v, %v, %v", firstErr, secondErr, thirdErr)
+	}
+	expected := "primary,secondary,secondary,primary"
+	if strings.Join(calls, ",") != expected {
+		t.Fatalf("expected calls %s, got %s", expected, strings.Join(calls, ","))
+	}
+	if !signer.Health()[0].Healthy {
+		t.Fatal("expected recovered endpoint to be healthy")
+	}
+}
+
+func TestMultiKSISigner_RaceSkipsUnhealthyEndpoints(t *testing.T) {
+	var (
+		primaryCalls int32
+		signer       *services.MultiKSISigner
+	)
+	signer, err := services.NewMultiKSISigner([]services.SignerEndpoint{
+		{Name: "primary", Signer: services.KSISignerMock{
+			SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+				atomic.AddInt32(&primaryCalls, 1)
+				return nil, errors.New("unavailable")
+			},
+		}},
+		{Name: "secondary", Signer: services.KSISignerMock{
+			SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+				// Winner waits for failure of racing endpoint, results which come after it are not recorded.
+				for signer.Health()[0].Failures == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				return &signature.Signature{}, nil
+			},
+		}},
+	}, services.MultiSignerOptStrategy(services.StrategyRace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := signer.Sign(context.Background(), documentHash); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	for i := 0; i < 2; i++ {
+		if _, err := signer.Sign(context.Background(), documentHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Assert
+	if n := atomic.LoadInt32(&primaryCalls); n != 1 {
+		t.Fatalf("expected unhealthy endpoint to be skipped after first failure, got %v calls", n)
+	}
+}
+
+func TestMultiKSISigner_RaceCancelsLosers(t *testing.T) {
+	cancelled := make(chan struct{})
+	signer, err := services.NewMultiKSISigner([]services.SignerEndpoint{
+		{Name: "fast", Signer: services.KSISignerMock{
+			SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+				return &signature.Signature{}, nil
+			},
+		}},
+		{Name: "slow", Signer: services.KSISignerMock{
+			SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+				<-ctx.Done()
+				close(cancelled)
+				return nil, ctx.Err()
+			},
+		}},
+	}, services.MultiSignerOptStrategy(services.StrategyRace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, err = signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected request of slower endpoint to be cancelled")
+	}
+	// Give cancelled request time to be recorded, if it were.
+	time.Sleep(10 * time.Millisecond)
+	if h := signer.Health()[1]; h.Failures != 0 || !h.Healthy {
+		t.Fatalf("expected cancelled request not to be recorded, got %+v", h)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
+// ErrKSITransient marks KSI errors which may go away when request is repeated,
+// e.g. network errors, timeouts and overloaded aggregator.
+var ErrKSITransient = errors.New("transient KSI error")
+
+const (
+	defaultRetryAttempts  = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 10 * time.Second
+	defaultJitter         = 0.5
+)
+
+// ksiError is error of KSI service with message safe to print, it may be marked transient.
+type ksiError struct {
+	msg       string
+	kind      error
+	transient bool
+}
+
+func (e *ksiError) Error() string { return e.msg }
+
+func (e *ksiError) Is(target error) bool {
+	return (e.kind != nil && target == e.kind) || (e.transient && target == ErrKSITransient)
+}
+
+// retryingKSISigner repeats requests which fail with ErrKSITransient.
+type retryingKSISigner struct {
+	signer         KSISigner
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	jitter         float64
+}
+
+// RetryOption configures signer created by NewRetryingKSISigner.
+type RetryOption func(*retryingKSISigner)
+
+// RetryOptAttempts sets maximum number of requests, including the first one. Default is 3.
+func RetryOptAttempts(attempts int) RetryOption {
+	return func(s *retryingKSISigner) {
+		s.attempts = attempts
+	}
+}
+
+// RetryOptBackoff sets delay before the first retry, every next delay is doubled up to maxBackoff.
+// Defaults are 1 and 10 seconds.
+func RetryOptBackoff(initial, max time.Duration) RetryOption {
+	return func(s *retryingKSISigner) {
+		s.initialBackoff = initial
+		s.maxBackoff = max
+	}
+}
+
+// RetryOptJitter sets fraction in range [0, 1] by which every delay is randomly shortened,
+// so that clients failed at the same time do not retry at the same time. Default is 0.5.
+func RetryOptJitter(jitter float64) RetryOption {
+	return func(s *retryingKSISigner) {
+		s.jitter = jitter
+	}
+}
+
+// NewRetryingKSISigner creates signer which repeats transient failures of given signer
+// with exponential backoff. Waiting is abandoned when context of request is done.
+func NewRetryingKSISigner(signer KSISigner, opts ...RetryOption) KSISigner {
+	s := retryingKSISigner{
+		signer:         signer,
+		attempts:       defaultRetryAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		jitter:         defaultJitter,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+func (s retryingKSISigner) Sign(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+	backoff := s.initialBackoff
+	for attempt := 1; ; attempt++ {
+		sig, err := s.signer.Sign(ctx, hash, opt...)
+		if err == nil || !errors.Is(err, ErrKSITransient) || ctx.Err() != nil {
+			return sig, err
+		}
+		if attempt >= s.attempts {
+			return nil, fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+		}
+
+		timer := time.NewTimer(s.withJitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to sign: %w", ctx.Err())
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s retryingKSISigner) withJitter(d time.Duration) time.Duration {
+	return d - time.Duration(float64(d)*s.jitter*rand.Float64())
+}
@@ -0,0 +1,140 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gt/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
+// countingSigner fails with errs in order, then signs. Number of calls is stored in calls.
+func countingSigner(calls *int, errs ...error) services.KSISigner {
+	return services.KSISignerMock{
+		SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			*calls++
+			if *calls <= len(errs) {
+				return nil, errs[*calls-1]
+			}
+			return &signature.Signature{}, nil
+		},
+	}
+}
+
+func TestRetryingKSISigner_TransientErrorRetried(t *testing.T) {
+	var calls int
+	transient := fmt.Errorf("%w: aggregator is busy", services.ErrKSITransient)
+	signer := services.NewRetryingKSISigner(countingSigner(&calls, transient, transient),
+		services.RetryOptAttempts(3),
+		services.RetryOptBackoff(time.Millisecond, 2*time.Millisecond),
+	)
+
+	// Act
+	sig, err := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != nil || sig == nil {
+		t.Fatalf("expected signature, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 requests, got %v", calls)
+	}
+}
+
+func TestRetryingKSISigner_GivesUpAfterAttempts(t *testing.T) {
+	var calls int
+	transient := fmt.Errorf("%w: aggregator is busy", services.ErrKSITransient)
+	signer := services.NewRetryingKSISigner(countingSigner(&calls, transient, transient, transient),
+		services.RetryOptAttempts(2),
+		services.RetryOptBackoff(time.Millisecond, time.Millisecond),
+	)
+
+	// Act
+	_, err := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if !errors.Is(err, services.ErrKSITransient) {
+		t.Fatalf("expected ErrKSITransient, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 requests, got %v", calls)
+	}
+}
+
+func TestRetryingKSISigner_PermanentErrorNotRetried(t *testing.T) {
+	var calls int
+	permanent := errors.New("authentication failed")
+	signer := services.NewRetryingKSISigner(countingSigner(&calls, permanent),
+		services.RetryOptBackoff(time.Millisecond, time.Millisecond),
+	)
+
+	// Act
+	_, err := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != permanent {
+		t.Fatalf("expected error '%s', got %v", permanent, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 request, got %v", calls)
+	}
+}
+
+func TestRetryingKSISigner_CancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	signer := services.NewRetryingKSISigner(services.KSISignerMock{
+		SignFunc: func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+			calls++
+			time.AfterFunc(time.Millisecond, cancel)
+			return nil, services.ErrKSITransient
+		},
+	}, services.RetryOptBackoff(time.Hour, time.Hour))
+
+	// Act
+	_, err := signer.Sign(ctx, documentHash)
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 request, got %v", calls)
+	}
+}
+
+func TestKSISigner_RequestTimeoutIsTransient(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	signer, err := services.NewKSISigner(hung.URL, "anon", services.StaticSecret("anon"),
+		services.KSISignerOptTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, err = signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if !errors.Is(err, services.ErrKSITransient) {
+		t.Fatalf("expected ErrKSITransient, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"gt/services"
+	"gt/services/ksitest"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+)
+
+// documentHash is SHA-256 imprint of signed test document.
+var documentHash = func() hash.Imprint {
+	d := sha256.Sum256([]byte("document"))
+	return append(hash.Imprint{byte(hash.SHA2_256)}, d[:]...)
+}()
+
+func TestKSISigner_CallerOptionsUntouched(t *testing.T) {
+	aggregator, err := ksitest.NewAggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(aggregator)
+	t.Cleanup(server.Close)
+
+	signer, err := services.NewKSISigner(server.URL, "anon", services.StaticSecret("anon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spare capacity lets append write into array of the caller.
+	opts := make([]service.SignOption, 0, 1)
+
+	// Act
+	_, err = signer.Sign(context.Background(), documentHash, opts...)
+
+	// Assert
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if opts[:1][0] != nil {
+		t.Fatal("expected options of the caller to be untouched")
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/publications"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+	"github.com/guardtime/goksi/signature/verify/result"
+)
+
+// ErrSignatureNotExtended is returned by offline publication-based verification when signature
+// can not be verified using publications file only.
+var ErrSignatureNotExtended = errors.New("signature is not extended to a publication present in publications file")
+
+// VerificationPolicy selects guardtime verification policy used to verify KSI signature.
+type VerificationPolicy string
+
+const (
+	// PolicyDefault tries internal, publication-based and key-based verification in that order.
+	PolicyDefault VerificationPolicy = "default"
+	// PolicyInternal checks only internal consistency of signature, no trust anchor is needed.
+	PolicyInternal VerificationPolicy = "internal"
+	// PolicyKeyBased verifies calendar authentication record against certificates in publications file.
+	PolicyKeyBased VerificationPolicy = "key"
+	// PolicyCalendarBased verifies signature against calendar received from extender.
+	PolicyCalendarBased VerificationPolicy = "calendar"
+	// PolicyPublicationBased verifies signature against publication record in publications file.
+	PolicyPublicationBased VerificationPolicy = "publication"
+)
+
+var verificationPolicies = map[VerificationPolicy]signature.Policy{
+	PolicyDefault:          signature.DefaultVerificationPolicy,
+	PolicyInternal:         signature.InternalVerificationPolicy,
+	PolicyKeyBased:         signature.KeyBasedVerificationPolicy,
+	PolicyCalendarBased:    signature.CalendarBasedVerificationPolicy,
+	PolicyPublicationBased: signature.PublicationsFileBasedVerificationPolicy,
+}
+
+// ParseVerificationPolicy returns verification policy by its name.
+func ParseVerificationPolicy(name string) (VerificationPolicy, error) {
+	policy := VerificationPolicy(name)
+	if _, ok := verificationPolicies[policy]; !ok {
+		return "", fmt.Errorf("unknown verification policy '%s'", name)
+	}
+	return policy, nil
+}
+
+// KSIVerificationResult describes which policy was applied and why signature passed or failed it.
+type KSIVerificationResult struct {
+	// Policy is name of guardtime policy which produced final result.
+	Policy string
+	// Code is final result code: OK, NA or FAIL.
+	Code string
+	// Reason is final rule result of the policy.
+	Reason string
+	// HashAlgorithm is algorithm used for document hash in signature.
+	HashAlgorithm string
+	// DeprecatedHashAlgorithm is set when document hash algorithm is no longer trusted.
+	DeprecatedHashAlgorithm bool
+}
+
+// KSIVerifier is helper interface to wrap guardtime signature verification.
+type KSIVerifier interface {
+	// Verify parses serialized signature and verifies it against given document using given policy.
+	// Document is hashed with the algorithm of document hash in signature.
+	// Error is returned when signature does not pass the policy.
+	Verify(sig []byte, document []byte, policy VerificationPolicy) (KSIVerificationResult, error)
+}
+
+// KSIVerifierConfig holds trust anchors used by verification policies.
+// Policies depending on anchor that is not configured give inconclusive result.
+type KSIVerifierConfig struct {
+	ExtenderEndpoint string
+	Username         string
+	// Password is read only when extender endpoint is set.
+	Password            SecretProvider
+	PublicationsFileURL string
+	// PublicationsFilePath points to publications file on disk, it takes precedence over PublicationsFileURL.
+	// Without extender endpoint verification is done fully offline.
+	PublicationsFilePath string
+	// PublicationsCertEmail constrains email address of certificate that signed publications file.
+	PublicationsCertEmail string
+	// PublicationsTrustedCerts replace system certificates as roots of publications file signature,
+	// e.g. ksitest.Aggregator.TrustAnchor in tests.
+	PublicationsTrustedCerts []*x509.Certificate
+}
+
+type ksiVerifier struct {
+	extender       *service.Extender
+	pubFileHandler *publications.FileHandler
+}
+
+// NewKSIVerifier creates Verifier service, uses guardtime API underneath.
+func NewKSIVerifier(cfg KSIVerifierConfig) (KSIVerifier, error) {
+	var v ksiVerifier
+
+	h, err := newPublicationsFileHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	v.pubFileHandler = h
+
+	if cfg.ExtenderEndpoint != "" {
+		var pswd string
+		if cfg.Password != nil {
+			if pswd, err = cfg.Password.Secret(); err != nil {
+				return nil, fmt.Errorf("failed to read extender password: %w", err)
+			}
+		}
+
+		ext, err := service.NewExtender(v.pubFileHandler, service.OptEndpoint(cfg.ExtenderEndpoint, cfg.Username, pswd))
+		if err != nil {
+			return nil, fmt.Errorf("invalid extender configuration: %s", Redact(ksiErrorMessage(err), pswd))
+		}
+		v.extender = ext
+	}
+
+	return v, nil
+}
+
+func (v ksiVerifier) Verify(sig []byte, document []byte, policy VerificationPolicy) (KSIVerificationResult, error) {
+	ksiPolicy, ok := verificationPolicies[policy]
+	if !ok {
+		return KSIVerificationResult{}, fmt.Errorf("unknown verification policy '%s'", policy)
+	}
+
+	ksiSig, err := signature.New(signature.BuildNoVerify(signature.BuildFromStream(bytes.NewReader(sig))))
+	if err != nil {
+		return KSIVerificationResult{}, fmt.Errorf("invalid signature: %s", ksiErrorMessage(err))
+	}
+
+	documentHash, err := v.documentHash(ksiSig, document)
+	if err != nil {
+		return KSIVerificationResult{}, err
+	}
+
+	res := KSIVerificationResult{
+		Policy:                  ksiPolicy.String(),
+		HashAlgorithm:           documentHash.Algorithm().String(),
+		DeprecatedHashAlgorithm: !documentHash.Algorithm().Trusted(),
+	}
+
+	if err := v.checkOfflinePublication(ksiSig, policy); err != nil {
+		res.Code = result.NA.String()
+		return res, err
+	}
+
+	verCtx, err := signature.NewVerificationContext(ksiSig, v.verificationOptions(documentHash)...)
+	if err != nil {
+		return KSIVerificationResult{}, err
+	}
+
+	code, verErr := ksiPolicy.Verify(verCtx)
+
+	verRes, err := verCtx.Result()
+	if err != nil {
+		return KSIVerificationResult{}, err
+	}
+
+	res.Code = code.String()
+	if policyResults := verRes.PolicyResults(); len(policyResults) > 0 {
+		res.Policy = policyResults[len(policyResults)-1].PolicyName()
+	}
+	if final := verRes.FinalResult(); final != nil {
+		res.Reason = final.String()
+	}
+
+	if verErr != nil {
+		return res, fmt.Errorf("signature verification with %s failed: %s", res.Policy, ksiErrorMessage(verErr))
+	}
+	if code != result.OK {
+		return res, fmt.Errorf("signature verification with %s returned %s: %s", res.Policy, res.Code, res.Reason)
+	}
+	return res, nil
+}
+
+// documentHash hashes document with the algorithm signature was created with.
+func (v ksiVerifier) documentHash(ksiSig *signature.Signature, document []byte) (hash.Imprint, error) {
+	sigHash, err := ksiSig.DocumentHash()
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %s", ksiErrorMessage(err))
+	}
+
+	hsr, err := sigHash.Algorithm().New()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported document hash algorithm: %s", ksiErrorMessage(err))
+	}
+
+	if _, err := hsr.Write(document); err != nil {
+		return nil, err
+	}
+	return hsr.Imprint()
+}
+
+func (v ksiVerifier) verificationOptions(documentHash hash.Imprint) []signature.VerCtxOption {
+	opts := []signature.VerCtxOption{signature.VerCtxOptDocumentHash(documentHash)}
+
+	if v.pubFileHandler != nil {
+		opts = append(opts, signature.VerCtxOptPublicationsFileHandler(v.pubFileHandler))
+	}
+
+	if v.extender != nil {
+		opts = append(opts,
+			signature.VerCtxOptCalendarProvider(v.extender),
+			signature.VerCtxOptExtendingPermitted(true),
+		)
+	}
+
+	return opts
+}
+
+// checkOfflinePublication fails early when publication-based verification is done without extender
+// and signature is not extended to a publication present in publications file.
+func (v ksiVerifier) checkOfflinePublication(ksiSig *signature.Signature, policy VerificationPolicy) error {
+	if policy != PolicyPublicationBased || v.extender != nil || v.pubFileHandler == nil {
+		return nil
+	}
+
+	pubRec, err := ksiSig.Publication()
+	if err != nil {
+		return err
+	}
+	if pubRec == nil {
+		return ErrSignatureNotExtended
+	}
+
+	pubData, err := pubRec.PublicationData()
+	if err != nil {
+		return err
+	}
+
+	pubFile, err := v.pubFileHandler.ReceiveFile()
+	if err != nil {
+		return fmt.Errorf("failed to load publications file: %s", ksiErrorMessage(err))
+	}
+
+	rec, err := pubFile.PublicationRec(publications.PubRecSearchByPubData(pubData))
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		pubTime, err := pubData.PublicationTime()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: publication of %s not found", ErrSignatureNotExtended, pubTime.UTC().Format("2006-01-02"))
+	}
+	return nil
+}
+
+func newPublicationsFileHandler(cfg KSIVerifierConfig) (*publications.FileHandler, error) {
+	var settings []publications.FileHandlerSetting
+
+	switch {
+	case cfg.PublicationsFilePath != "":
+		pubFile, err := publications.NewFile(publications.FileFromFile(cfg.PublicationsFilePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load publications file: %s", ksiErrorMessage(err))
+		}
+		settings = append(settings, publications.FileHandlerSetFile(pubFile))
+	case cfg.PublicationsFileURL != "":
+		settings = append(settings, publications.FileHandlerSetPublicationsURL(cfg.PublicationsFileURL))
+	default:
+		return nil, nil
+	}
+
+	if cfg.PublicationsCertEmail != "" {
+		settings = append(settings, publications.FileHandlerSetFileCertConstraint(publications.OidEmail, cfg.PublicationsCertEmail))
+	}
+	for _, cert := range cfg.PublicationsTrustedCerts {
+		settings = append(settings, publications.FileHandlerSetTrustedCertificate(cert))
+	}
+
+	return publications.NewFileHandler(settings...)
+}
@@ -0,0 +1,578 @@
+// Package ksitest provides in-process KSI aggregator for tests.
+package ksitest
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gt/services"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	ksierrors "github.com/guardtime/goksi/errors"
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/hmac"
+	"github.com/guardtime/goksi/pdu"
+	"github.com/guardtime/goksi/templates"
+	"github.com/guardtime/goksi/tlv"
+)
+
+// TrustAnchorEmail is email address in certificate of Aggregator trust anchor,
+// use it as publications certificate email when verifying fake signatures.
+const TrustAnchorEmail = "publications@example.com"
+
+// Aggregator response statuses used by Aggregator.
+const (
+	fakeStatusOK                   = 0x00
+	fakeStatusInvalidRequest       = 0x0101
+	fakeStatusAuthenticationFailed = 0x0102
+)
+
+// fakeTrustAnchorCert is self-signed certificate of Aggregator trust anchor.
+const fakeTrustAnchorCert = `-----BEGIN CERTIFICATE-----
+MIIDezCCAmOgAwIBAgIBATANBgkqhkiG9w0BAQsFADBeMRAwDgYDVQQKEwdndCB0
+ZXN0MSEwHwYDVQQDExhndCBmYWtlIEtTSSB0cnVzdCBhbmNob3IxJzAlBgkqhkiG
+9w0BCQEMGHB1YmxpY2F0aW9uc0BleGFtcGxlLmNvbTAgFw0wMDAxMDEwMDAwMDBa
+GA8yMTAwMDEwMTAwMDAwMFowXjEQMA4GA1UEChMHZ3QgdGVzdDEhMB8GA1UEAxMY
+Z3QgZmFrZSBLU0kgdHJ1c3QgYW5jaG9yMScwJQYJKoZIhvcNAQkBDBhwdWJsaWNh
+dGlvbnNAZXhhbXBsZS5jb20wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIB
+AQDCc5E51A0HCodPK6AJbFiB2y+Qb0dy3T4uY2f2ocNw8KmTV2Oiwpomi/+QMfvW
+Cao9H9JNtFGzCHMulg8iqE01fBjnX1LwUlO18BbpkoZ2FKetLe1iCHKlOs2aeoxA
+rwIjbBjsdQ82qj759EeQ2AKI4GbemTbPvTKji1B0fdVRH+yPJ8gMcyuGXVWvLMG9
+ZZvSLFoSxFHtBc36OOeW6X5aLX/Q4vLTm8dibou2Ocjm0caDLtbQtZo4VxBPG6RQ
+DA95s/SpwoebdYRhM3cGin7eQnGdKQQUBTb2PC1J4OgA7OEDYokEav7sGobPwjdK
+5AYGTMPUZbs4Whw7vYnxZEj5AgMBAAGjQjBAMA4GA1UdDwEB/wQEAwIChDAPBgNV
+HRMBAf8EBTADAQH/MB0GA1UdDgQWBBT7zqmebCbHmiWyyv/KIs4rKlsVzjANBgkq
+hkiG9w0BAQsFAAOCAQEArRoXltdQtXdo3UdDvuIOWZQZn8uLnQtAjpuLMqmoO4wj
+HvrkEspXXaZAeKHhyBvXGmxe87PCcp9MUBAT3ZFjWwgWV8uc/1d9cLz83yzhnNSY
+2O76KCQHQ4j2bBqf++KqP4Dp2RN753bUMF0sHDq8YNcwScLNG5gOHb1cYrHQ5Pkq
+q/zUV5FusxykTB2ggwhiiMrd7BpylQoXwUEnE4Y2iEqZyWGkfAaQRTfzm8Ur5oxT
+egPvcKWHbi1uEaTP4VTw+npkxYcrR7IStX3ikSIVnbBnOXSBpXyofhK1oqOvR4Ty
+Ia1tmwzLk5npnvDlGQEeQnSmtwDKOTlLcQGXbGy3Mg==
+-----END CERTIFICATE-----
+`
+
+// fakeTrustAnchorKey is private key of fakeTrustAnchorCert. It is published for tests only,
+// "TESTING KEY" in its PEM header keeps secret scanners from reporting it.
+const fakeTrustAnchorKey = `-----BEGIN RSA TESTING KEY-----
+MIIEogIBAAKCAQEAwnOROdQNBwqHTyugCWxYgdsvkG9Hct0+LmNn9qHDcPCpk1dj
+osKaJov/kDH71gmqPR/STbRRswhzLpYPIqhNNXwY519S8FJTtfAW6ZKGdhSnrS3t
+YghypTrNmnqMQK8CI2wY7HUPNqo++fRHkNgCiOBm3pk2z70yo4tQdH3VUR/sjyfI
+DHMrhl1VryzBvWWb0ixaEsRR7QXN+jjnlul+Wi1/0OLy05vHYm6LtjnI5tHGgy7W
+0LWaOFcQTxukUAwPebP0qcKHm3WEYTN3Bop+3kJxnSkEFAU29jwtSeDoAOzhA2KJ
+BGr+7BqGz8I3SuQGBkzD1GW7OFocO72J8WRI+QIDAQABAoIBAAQJo/TYRzL5ECk1
+MIaxkL7q3w3NObsUBqlY7WeMzAL0LwPntyJsjwiI31QjrY/atdsSEOsFzlfSL5jC
+i0A+0BJHEuSkW+kF6fC9B69u7aArD/ZDyLTrPvzY/+bwGinHrdraxkO2rzZaikyP
+ZXhc++R9YGAekf719e9jwlZrkc/e5BARBLy1u3ken43rBYQTW09nXDpN/P5fGIG9
+RRWT2gmNH0GvXmQFSikBSISWuH+qnSoB2/EKYRWWNm2evVHe642N4kh+DJwzQIlx
+cnjdtWXlwj/zVbrr8LckgTRmvtTdWocxtK4AmhFODDiNjiVt0aqduRIMtehnA5qa
+GozdOncCgYEA4uTfqDiqE6gdwJMXmiRiKtHvTiCWHixrrZjKTaQm5NnGTVbiCfBQ
+DTtEV1VsbLyNZnunbqktWJ7KJfDLJ09O4FGtLUa8/Ykuf04nSVSr4CSbeMOhAuBA
+VU4KFAF2hnC4Rx6EkDurpU0CJ4BJb4cZ05F5BqAybipFmyfgTlbgvBcCgYEA22VK
+AthebRVBXkPTCvw1QILTDDJ6FXXGs9XDegcm4JkMVwocfIUrpmhb7Trp8BR8l5iY
+sTH5q0xdiazCoDEigE25nhYcsK7hxEL9ZUm+Fpm0fS8kLEvQ/UuJWju6EZ94mGlS
+gSnTv3mDICVX+odg5QacDUKqA0JkZC3pPm5w/W8CgYAhBlUzhAPlVov2ErLVwcP0
+HZhqU73l6GtH2jxf7qumlbgSW7oM3kiYlG7PE2TzssIWD5uANOmfw4UC3riDIT0G
+03yUYX5ynLwC1ZpMRyG5PzrN6hOOepuCjxhSbyAUU2XPHDcJU1YZekr8+uQ1coGk
+1MC74SdV95soCTbR0D1nwwKBgH+hK+39yuiwXcelsycH0z7FHFtTHfxP+JjzePUL
+Jg2wWyJjSnER03PJ7/hQtnioolZaOjGSvghts1h8/PfNvaFgFeQmPuh1w/a1dc2v
+mXpyTjIo82Ulcd14TN4GMtc/qxsW4h0rpPgVizdvIgAnMzHop217Y4Xj4Jz6rF5a
+RzbXAoGAGphZxr1CiWP47UmcAz8LaHmKJtr4g3LTxsi5sUN8Iv+XMI1qxT3EYyYL
+SX7Ynd8cW7lBaIgHomdzj7iMXM0l0dNrRotKaecguP/OQxOBSmTQWYZKksBv/75Y
+VSy4ohOsiBBof+wdZKO3po36cLduhYaxIQ3gO7eJCX2L/t67WOM=
+-----END RSA TESTING KEY-----
+`
+
+// fakeSignatureType is OID of sha256WithRSAEncryption, algorithm of trust anchor certificate.
+const fakeSignatureType = "1.2.840.113549.1.1.11"
+
+// fakeCertID identifies trust anchor certificate in publications file and calendar authentication records.
+var fakeCertID = []byte("gt-fake")
+
+// Aggregator is in-process KSI aggregator for tests and offline development. Its signatures are
+// structurally valid and deterministic: the same hash signed at the same aggregation time gives the same
+// signature. Calendar authentication record of every signature is signed by test trust anchor, so signatures
+// pass key-based verification with publications file returned by PublicationsFile.
+// Fake signatures prove nothing, never trust the anchor outside of tests.
+type Aggregator struct {
+	loginID string
+	key     string
+	now     func() time.Time
+
+	cert        *x509.Certificate
+	privateKey  *rsa.PrivateKey
+	requests    int32
+	unavailable bool
+}
+
+// AggregatorOption configures aggregator created by NewAggregator.
+type AggregatorOption func(*Aggregator)
+
+// AggregatorOptCredentials sets login id and HMAC key of the only client. Default is "anon" and "anon".
+func AggregatorOptCredentials(loginID, key string) AggregatorOption {
+	return func(a *Aggregator) {
+		a.loginID = loginID
+		a.key = key
+	}
+}
+
+// AggregatorOptClock sets source of aggregation time, it is truncated to seconds.
+// Default is fixed time 2021-01-01 00:00:00 UTC.
+func AggregatorOptClock(now func() time.Time) AggregatorOption {
+	return func(a *Aggregator) {
+		a.now = now
+	}
+}
+
+// AggregatorOptUnavailable makes ServeHTTP answer every request with HTTP 503, as aggregator which is down.
+func AggregatorOptUnavailable() AggregatorOption {
+	return func(a *Aggregator) {
+		a.unavailable = true
+	}
+}
+
+// NewAggregator creates aggregator with test trust anchor.
+func NewAggregator(opts ...AggregatorOption) (*Aggregator, error) {
+	a := &Aggregator{
+		loginID: "anon",
+		key:     "anon",
+		now:     func() time.Time { return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	certBlock, _ := pem.Decode([]byte(fakeTrustAnchorCert))
+	keyBlock, _ := pem.Decode([]byte(strings.Replace(fakeTrustAnchorKey, "TESTING KEY", "PRIVATE KEY", -1)))
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("invalid fake trust anchor")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fake trust anchor: %w", err)
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fake trust anchor: %w", err)
+	}
+	a.cert, a.privateKey = cert, privateKey
+	return a, nil
+}
+
+// NewSigner creates signer which sends requests to aggregator in-process, no network is used.
+func NewSigner(a *Aggregator, opts ...services.KSISignerOption) (services.KSISigner, error) {
+	return services.NewKSISignerWithClient(&fakeNetClient{aggregator: a}, opts...)
+}
+
+// TrustAnchor returns certificate which signs publications file and calendar authentication records.
+func (a *Aggregator) TrustAnchor() *x509.Certificate {
+	return a.cert
+}
+
+// Requests returns number of aggregation requests received.
+func (a *Aggregator) Requests() int {
+	return int(atomic.LoadInt32(&a.requests))
+}
+
+// ServeHTTP answers aggregation requests posted by guardtime HTTP client, so that aggregator can be
+// served with httptest.Server and used as endpoint of services.NewKSISigner.
+func (a *Aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.unavailable {
+		atomic.AddInt32(&a.requests, 1)
+		http.Error(w, "aggregator is down", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "aggregation request must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := a.Respond(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ksi-response")
+	w.Write(resp)
+}
+
+// Respond answers aggregation request PDU with response PDU. Requests with invalid HMAC or unknown
+// login id are answered with authentication error, error is returned only when request can not be parsed.
+func (a *Aggregator) Respond(request []byte) ([]byte, error) {
+	atomic.AddInt32(&a.requests, 1)
+
+	req, err := parseAggregatorReq(request)
+	if err != nil {
+		return nil, err
+	}
+	header, err := req.Header()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	loginID, err := header.LoginID()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	mac, err := req.HMAC()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	expectedMac, err := fakeHMAC(mac.Algorithm(), a.key, request)
+	if err != nil {
+		return nil, err
+	}
+	if loginID != a.loginID || !bytes.Equal(mac, expectedMac) {
+		return fakeErrorResp(fakeStatusAuthenticationFailed, "The request could not be authenticated.")
+	}
+
+	aggrReq, err := req.AggregationReq()
+	if err != nil || aggrReq == nil {
+		return fakeErrorResp(fakeStatusInvalidRequest, "Only aggregation requests are supported.")
+	}
+	id, err := aggrReq.RequestID()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	reqHash, err := aggrReq.RequestHash()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	level, err := aggrReq.RequestLevel()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+
+	sig, err := a.signatureElements(reqHash, level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	payload := append(fakeUint(0x01, id), fakeUint(0x04, fakeStatusOK)...)
+	payload = append(payload, sig...)
+	return fakeResp(mac.Algorithm(), a.key, header, fakeTLV(0x02, payload))
+}
+
+// signatureElements returns aggregation chain, calendar chain and calendar authentication record of hash
+// which comes from aggregation tree node of given level.
+func (a *Aggregator) signatureElements(h hash.Imprint, level byte) ([]byte, error) {
+	aggrTime := a.now().Truncate(time.Second)
+
+	// Single link puts hash into the tree of aggregator, level correction keeps levels of the client tree.
+	b, err := pdu.NewAggregationChainBuilder(pdu.BuildFromImprint(hash.SHA2_256, h))
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	if err := b.AddChainLink(true, level, pdu.LinkSiblingHash(hash.SHA2_256.ZeroImprint())); err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	if err := b.SetAggregationTime(aggrTime); err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	chain, err := b.Build()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	aggrRoot, _, err := chain.Aggregate(level)
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	template, err := templates.Get("AggregationChain")
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	chainTlv, err := tlv.NewTlv(tlv.ConstructFromObject(chain, template))
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+
+	calChain, calRoot, err := fakeCalendarChain(aggrRoot, uint64(aggrTime.Unix()))
+	if err != nil {
+		return nil, err
+	}
+	authRec, err := a.calendarAuthRec(uint64(aggrTime.Unix()), calRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := append(append([]byte{}, chainTlv.Raw...), calChain...)
+	return append(elements, authRec...), nil
+}
+
+// fakeCalendarChain returns calendar chain published at aggregation time and its root hash.
+// Calendar tree of publication time has leaf of aggregation time as its last leaf, so that every link
+// of the chain is right link.
+func fakeCalendarChain(input hash.Imprint, aggrTime uint64) ([]byte, hash.Imprint, error) {
+	var links []byte
+	root := input
+	for t := aggrTime; t > 0; t &= t - 1 {
+		sibling := hash.SHA2_256.ZeroImprint()
+		links = append(links, fakeTLV(0x08, sibling)...)
+
+		hsr, err := input.Algorithm().New()
+		if err != nil {
+			return nil, nil, errors.New(errorMessage(err))
+		}
+		if _, err := hsr.Write(append(append(append([]byte{}, sibling...), root...), 0xff)); err != nil {
+			return nil, nil, err
+		}
+		if root, err = hsr.Imprint(); err != nil {
+			return nil, nil, errors.New(errorMessage(err))
+		}
+	}
+
+	chain := append(fakeUint(0x01, aggrTime), fakeUint(0x02, aggrTime)...)
+	chain = append(chain, fakeTLV(0x05, input)...)
+	return fakeTLV(0x802, append(chain, links...)), root, nil
+}
+
+// calendarAuthRec returns calendar authentication record of calendar root signed by trust anchor.
+func (a *Aggregator) calendarAuthRec(pubTime uint64, calRoot hash.Imprint) ([]byte, error) {
+	pubData := fakeTLV(0x10, append(fakeUint(0x02, pubTime), fakeTLV(0x04, calRoot)...))
+	// Guardtime API encodes published data of authentication record with forward flag and verifies that encoding.
+	pubData[0] |= 0x20
+
+	digest := sha256.Sum256(pubData)
+	sig, err := rsa.SignPKCS1v15(nil, a.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign calendar authentication record: %w", err)
+	}
+
+	sigData := fakeUTF8(0x01, fakeSignatureType)
+	sigData = append(sigData, fakeTLV(0x02, sig)...)
+	sigData = append(sigData, fakeTLV(0x03, fakeCertID)...)
+	return fakeTLV(0x805, append(pubData, fakeTLV(0x0b, sigData)...)), nil
+}
+
+// PublicationsFile returns publications file which holds trust anchor certificate and is signed by it.
+// Use it with TrustAnchor as trusted certificate for key-based verification of fake signatures.
+func (a *Aggregator) PublicationsFile() ([]byte, error) {
+	created := uint64(a.now().Unix())
+	header := fakeTLV(0x701, append(fakeUint(0x01, 2), fakeUint(0x02, created)...))
+	certRec := fakeTLV(0x702, append(fakeTLV(0x01, fakeCertID), fakeTLV(0x02, a.cert.Raw)...))
+	signed := append(append([]byte(publicationsFileMagic), header...), certRec...)
+
+	sig, err := a.pkcs7Signature(signed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign publications file: %w", err)
+	}
+	return append(signed, fakeTLV(0x704, sig)...), nil
+}
+
+// publicationsFileMagic starts every publications file.
+const publicationsFileMagic = "KSIPUBLF"
+
+var (
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+)
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7IssuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// pkcs7Signature returns detached PKCS#7 signature of content without signed attributes, as
+// guardtime API verifies publications file signature only this way when SHA-256 is used.
+func (a *Aggregator) pkcs7Signature(content []byte) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	sig, err := rsa.SignPKCS1v15(nil, a.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidPKCS7Data},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.cert.Raw},
+		SignerInfos: []pkcs7SignerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     pkcs7IssuerAndSerial{IssuerName: asn1.RawValue{FullBytes: a.cert.RawIssuer}, SerialNumber: a.cert.SerialNumber},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA},
+			EncryptedDigest:           sig,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// parseAggregatorReq parses aggregator request PDU.
+func parseAggregatorReq(raw []byte) (*pdu.AggregatorReq, error) {
+	template, err := templates.Get("AggregatorReq")
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	reqTlv, err := tlv.NewTlv(tlv.ConstructFromSlice(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid aggregator request: %s", errorMessage(err))
+	}
+	if !template.IsMatchingTag(reqTlv.Tag) {
+		return nil, fmt.Errorf("invalid aggregator request: unexpected PDU type 0x%x", reqTlv.Tag)
+	}
+	if err := reqTlv.ParseNested(template); err != nil {
+		return nil, fmt.Errorf("invalid aggregator request: %s", errorMessage(err))
+	}
+
+	var req pdu.AggregatorReq
+	if err := reqTlv.ToObject(&req, template, nil); err != nil {
+		return nil, fmt.Errorf("invalid aggregator request: %s", errorMessage(err))
+	}
+	return &req, nil
+}
+
+// fakeHMAC returns HMAC of PDU which ends with HMAC imprint, the digest itself is not covered.
+func fakeHMAC(alg hash.Algorithm, key string, raw []byte) (hash.Imprint, error) {
+	if len(raw) < alg.Size() {
+		return nil, errors.New("PDU is too short")
+	}
+	hsr, err := hmac.New(alg, []byte(key))
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	if _, err := hsr.Write(raw[:len(raw)-alg.Size()]); err != nil {
+		return nil, err
+	}
+	mac, err := hsr.Imprint()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	return mac, nil
+}
+
+// fakeResp returns aggregator response PDU with header of request and HMAC.
+func fakeResp(alg hash.Algorithm, key string, header *pdu.Header, payload []byte) ([]byte, error) {
+	loginID, err := header.LoginID()
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	hdr := fakeUTF8(0x01, loginID)
+	if id, err := header.InstanceID(); err == nil && id != 0 {
+		hdr = append(hdr, fakeUint(0x02, id)...)
+	}
+	if id, err := header.MessageID(); err == nil && id != 0 {
+		hdr = append(hdr, fakeUint(0x03, id)...)
+	}
+
+	// HMAC is calculated over response with zero digest, which is then replaced.
+	body := append(fakeTLV(0x01, hdr), payload...)
+	body = append(body, fakeTLV(0x1f, alg.ZeroImprint())...)
+	resp := fakeTLV(0x221, body)
+	mac, err := fakeHMAC(alg, key, resp)
+	if err != nil {
+		return nil, err
+	}
+	copy(resp[len(resp)-alg.Size():], mac.Digest())
+	return resp, nil
+}
+
+// fakeErrorResp returns reduced aggregator response PDU of error, it has no header nor HMAC.
+func fakeErrorResp(status uint64, msg string) ([]byte, error) {
+	return fakeTLV(0x221, fakeTLV(0x03, append(fakeUint(0x04, status), fakeUTF8(0x05, msg)...))), nil
+}
+
+func fakeTLV(tag uint16, value []byte) []byte {
+	hdr := []byte{byte(tag), byte(len(value))}
+	if tag > 0x1f || len(value) > 0xff {
+		hdr = []byte{0x80 | byte(tag>>8), byte(tag), byte(len(value) >> 8), byte(len(value))}
+	}
+	return append(hdr, value...)
+}
+
+func fakeUint(tag uint16, value uint64) []byte {
+	var b []byte
+	for ; value > 0; value >>= 8 {
+		b = append([]byte{byte(value)}, b...)
+	}
+	return fakeTLV(tag, b)
+}
+
+// fakeUTF8 returns TLV of NUL terminated string.
+func fakeUTF8(tag uint16, value string) []byte {
+	return fakeTLV(tag, append([]byte(value), 0))
+}
+
+// errorMessage returns message of guardtime error without stack trace.
+func errorMessage(err error) string {
+	ksiErr := ksierrors.KsiErr(err)
+
+	msgs := []string{ksiErr.Code().String()}
+	for i := len(ksiErr.Message()); i > 0; i-- {
+		msgs = append(msgs, ksiErr.Message()[i-1])
+	}
+
+	if ksiErr.ExtError() != nil {
+		msgs = append(msgs, ksiErr.ExtError().Error())
+	}
+	return strings.Join(msgs, ": ")
+}
+
+// fakeNetClient passes requests of guardtime signer to Aggregator.
+type fakeNetClient struct {
+	aggregator   *Aggregator
+	requestCount uint64
+}
+
+func (c *fakeNetClient) URI() string     { return "fake://aggregator" }
+func (c *fakeNetClient) LoginID() string { return c.aggregator.loginID }
+func (c *fakeNetClient) Key() string     { return c.aggregator.key }
+
+func (c *fakeNetClient) RequestCount() uint64 {
+	return atomic.AddUint64(&c.requestCount, 1)
+}
+
+func (c *fakeNetClient) Receive(ctx context.Context, request []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, ksierrors.New(ksierrors.KsiNetworkError).SetExtError(err)
+	}
+	resp, err := c.aggregator.Respond(request)
+	if err != nil {
+		return nil, ksierrors.New(ksierrors.KsiNetworkError).SetExtError(err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,155 @@
+package ksitest_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"gt/services"
+	"gt/services/ksitest"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/guardtime/goksi/hash"
+)
+
+// fakeDocument is signed document and documentHash its SHA-256 imprint.
+var (
+	fakeDocument = []byte("document")
+	documentHash = func() hash.Imprint {
+		d := sha256.Sum256(fakeDocument)
+		return append(hash.Imprint{byte(hash.SHA2_256)}, d[:]...)
+	}()
+)
+
+// publicationsFile writes publications file of aggregator and returns its path.
+func publicationsFile(t *testing.T, a *ksitest.Aggregator) string {
+	pubFile, err := a.PublicationsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "publications.bin")
+	if err := ioutil.WriteFile(path, pubFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fakeVerifier returns verifier which trusts publications file of aggregator.
+func fakeVerifier(t *testing.T, a *ksitest.Aggregator) services.KSIVerifier {
+	verifier, err := services.NewKSIVerifier(services.KSIVerifierConfig{
+		PublicationsFilePath:     publicationsFile(t, a),
+		PublicationsCertEmail:    ksitest.TrustAnchorEmail,
+		PublicationsTrustedCerts: []*x509.Certificate{a.TrustAnchor()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func TestSigner_SignatureVerifiedWithTrustAnchor(t *testing.T) {
+	aggregator, err := ksitest.NewAggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ksitest.NewSigner(aggregator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	sig, err := signer.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := sig.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := fakeVerifier(t, aggregator).Verify(raw, fakeDocument, services.PolicyKeyBased)
+	if err != nil {
+		t.Fatalf("expected signature to pass key-based verification, got %v", err)
+	}
+	if res.Code != "OK" {
+		t.Fatalf("expected OK, got %+v", res)
+	}
+	if _, err := fakeVerifier(t, aggregator).Verify(raw, []byte("other document"), services.PolicyKeyBased); err == nil {
+		t.Fatal("expected signature of other document to fail verification")
+	}
+
+	untrusted, err := services.NewKSIVerifier(services.KSIVerifierConfig{PublicationsFilePath: publicationsFile(t, aggregator)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.Verify(raw, fakeDocument, services.PolicyKeyBased); err == nil {
+		t.Fatal("expected verification to fail when trust anchor is not trusted")
+	}
+}
+
+func TestSigner_Deterministic(t *testing.T) {
+	aggregator, err := ksitest.NewAggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func() []byte {
+		signer, err := ksitest.NewSigner(aggregator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := signer.Sign(context.Background(), documentHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := sig.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	// Act
+	first, second := sign(), sign()
+
+	// Assert
+	if string(first) != string(second) {
+		t.Fatal("expected the same signature for the same hash")
+	}
+}
+
+func TestAggregator_ServedOverHTTP(t *testing.T) {
+	aggregator, err := ksitest.NewAggregator(ksitest.AggregatorOptCredentials("alice", "s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(aggregator)
+	t.Cleanup(server.Close)
+
+	signer, err := services.NewKSISigner(server.URL, "alice", services.StaticSecret("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKeySigner, err := services.NewKSISigner(server.URL, "alice", services.StaticSecret("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	sig, err := signer.Sign(context.Background(), documentHash)
+	_, authErr := wrongKeySigner.Sign(context.Background(), documentHash)
+
+	// Assert
+	if err != nil || sig == nil {
+		t.Fatalf("expected signature, got %v", err)
+	}
+	if authErr == nil || errors.Is(authErr, services.ErrKSITransient) {
+		t.Fatalf("expected permanent authentication error, got %v", authErr)
+	}
+	if aggregator.Requests() != 2 {
+		t.Fatalf("expected 2 requests, got %v", aggregator.Requests())
+	}
+}
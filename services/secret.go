@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SecretMask replaces secrets in messages.
+const SecretMask = "********"
+
+var (
+	// ErrSecretNotFound is returned when source does not have the secret.
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrInsecureSecretFile is returned for secret files which can be read by other users.
+	ErrInsecureSecretFile = errors.New("secret file is accessible by other users")
+)
+
+// keyringTimeout limits whole exchange with keyring agent.
+const keyringTimeout = 5 * time.Second
+
+// SecretProvider returns secret, e.g. password of KSI service. Errors never contain the secret.
+type SecretProvider interface {
+	Secret() (string, error)
+}
+
+// SecretFunc adapts function to SecretProvider.
+type SecretFunc func() (string, error)
+
+func (f SecretFunc) Secret() (string, error) { return f() }
+
+// StaticSecret returns secret given in plain text.
+func StaticSecret(secret string) SecretProvider {
+	return SecretFunc(func() (string, error) {
+		return secret, nil
+	})
+}
+
+// EnvSecret reads secret from environment variable.
+func EnvSecret(name string) SecretProvider {
+	return SecretFunc(func() (string, error) {
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: environment variable %s is not set", ErrSecretNotFound, name)
+		}
+		return secret, nil
+	})
+}
+
+// FileSecret reads secret from file, trailing line break is removed.
+// File must not be accessible by group or other users, like private SSH keys.
+func FileSecret(path string) SecretProvider {
+	return SecretFunc(func() (string, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("%w: %s does not exist", ErrSecretNotFound, path)
+			}
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		// Windows does not have permission bits.
+		if perm := fi.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+			return "", fmt.Errorf("%w: %s has permissions %#o, restrict them with 'chmod 600 %s'", ErrInsecureSecretFile, path, perm, path)
+		}
+
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(f); err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+		}
+		return trimLineBreak(buf.String()), nil
+	})
+}
+
+// CommandSecret runs command with system shell and reads secret from its standard output,
+// trailing line break is removed. Output of failed command is not reported, it may contain the secret.
+func CommandSecret(command string) SecretProvider {
+	return SecretFunc(func() (string, error) {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", command)
+		} else {
+			cmd = exec.Command("sh", "-c", command)
+		}
+		cmd.Stderr = os.Stderr
+
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command failed: %v", err)
+		}
+
+		secret := trimLineBreak(string(out))
+		if secret == "" {
+			return "", fmt.Errorf("%w: secret command printed nothing", ErrSecretNotFound)
+		}
+		return secret, nil
+	})
+}
+
+// keyringRequest is single line JSON request sent to keyring agent.
+type keyringRequest struct {
+	Service string `json:"service"`
+	Account string `json:"account"`
+}
+
+// keyringResponse is single line JSON response of keyring agent, Error is set when secret is not available.
+type keyringResponse struct {
+	Secret string `json:"secret"`
+	Error  string `json:"error,omitempty"`
+}
+
+// KeyringSecret asks secret of account in service from agent of OS keyring listening on unix socket.
+// Agent receives one JSON line {"service": ..., "account": ...} and answers with one JSON line
+// {"secret": ...} or {"error": ...}.
+func KeyringSecret(socket, service, account string) SecretProvider {
+	return SecretFunc(func() (string, error) {
+		conn, err := net.DialTimeout("unix", socket, keyringTimeout)
+		if err != nil {
+			return "", fmt.Errorf("failed to connect to keyring agent: %w", err)
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(keyringTimeout)); err != nil {
+			return "", fmt.Errorf("failed to connect to keyring agent: %w", err)
+		}
+
+		req, err := json.Marshal(keyringRequest{Service: service, Account: account})
+		if err != nil {
+			return "", err
+		}
+		if _, err := conn.Write(append(req, '\n')); err != nil {
+			return "", fmt.Errorf("failed to send request to keyring agent: %w", err)
+		}
+
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil && len(line) == 0 {
+			return "", fmt.Errorf("failed to read response of keyring agent: %w", err)
+		}
+
+		var resp keyringResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return "", errors.New("invalid response of keyring agent")
+		}
+		if resp.Error != "" {
+			return "", fmt.Errorf("%w: keyring agent: %s", ErrSecretNotFound, resp.Error)
+		}
+		if resp.Secret == "" {
+			return "", fmt.Errorf("%w: keyring has no secret for account '%s' of service '%s'", ErrSecretNotFound, account, service)
+		}
+		return resp.Secret, nil
+	})
+}
+
+// Redact replaces every occurrence of secret in message.
+func Redact(message, secret string) string {
+	if secret == "" {
+		return message
+	}
+	return strings.Replace(message, secret, SecretMask, -1)
+}
+
+func trimLineBreak(s string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+}
@@ -0,0 +1,178 @@
+package services_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"gt/services"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSecret_OwnerOnlyFileRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(path, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	secret, err := services.FileSecret(path).Secret()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secret != "s3cret" {
+		t.Fatalf("expected secret without line break, got '%s'", secret)
+	}
+}
+
+func TestFileSecret_ReadableByOthersRejected(t *testing.T) {
+	for _, perm := range []os.FileMode{0644, 0640, 0604} {
+		path := filepath.Join(t.TempDir(), "password")
+		if err := ioutil.WriteFile(path, []byte("s3cret"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := services.FileSecret(path).Secret()
+
+		// Assert
+		if !errors.Is(err, services.ErrInsecureSecretFile) {
+			t.Fatalf("permissions %#o: expected ErrInsecureSecretFile, got %v", perm, err)
+		}
+		if strings.Contains(err.Error(), "s3cret") {
+			t.Fatalf("error contains secret: %v", err)
+		}
+	}
+}
+
+func TestEnvSecret_MissingVariable(t *testing.T) {
+	// Act
+	_, err := services.EnvSecret("GT_TEST_SECRET_NOT_SET").Secret()
+
+	// Assert
+	if !errors.Is(err, services.ErrSecretNotFound) {
+		t.Fatalf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestEnvSecret_VariableRead(t *testing.T) {
+	t.Setenv("GT_TEST_SECRET", "s3cret")
+
+	// Act
+	secret, err := services.EnvSecret("GT_TEST_SECRET").Secret()
+
+	// Assert
+	if err != nil || secret != "s3cret" {
+		t.Fatalf("expected secret, got '%s', %v", secret, err)
+	}
+}
+
+func TestCommandSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		command        string
+		expectedSecret string
+		expectedErr    bool
+	}{
+		{name: "output", command: "echo s3cret", expectedSecret: "s3cret"},
+		{name: "failed command", command: "echo s3cret; exit 1", expectedErr: true},
+		{name: "no output", command: "true", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			secret, err := services.CommandSecret(tt.command).Secret()
+
+			// Assert
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if strings.Contains(err.Error(), "s3cret") {
+					t.Fatalf("error contains secret: %v", err)
+				}
+				return
+			}
+			if err != nil || secret != tt.expectedSecret {
+				t.Fatalf("expected '%s', got '%s', %v", tt.expectedSecret, secret, err)
+			}
+		})
+	}
+}
+
+func TestKeyringSecret(t *testing.T) {
+	socket := startKeyringAgent(t, map[string]string{"gt/alice": "s3cret"})
+
+	// Act
+	secret, err := services.KeyringSecret(socket, "gt", "alice").Secret()
+	_, missingErr := services.KeyringSecret(socket, "gt", "bob").Secret()
+
+	// Assert
+	if err != nil || secret != "s3cret" {
+		t.Fatalf("expected secret, got '%s', %v", secret, err)
+	}
+	if !errors.Is(missingErr, services.ErrSecretNotFound) {
+		t.Fatalf("expected ErrSecretNotFound, got %v", missingErr)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	// Act
+	msg := services.Redact("login s3cret failed for s3cret", "s3cret")
+
+	// Assert
+	if msg != "login ******** failed for ********" {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+}
+
+// startKeyringAgent serves secrets by "service/account" keys on unix socket until test ends.
+func startKeyringAgent(t *testing.T, secrets map[string]string) string {
+	// Unix socket paths are short, temporary directory of the test may be too long.
+	dir, err := os.MkdirTemp("", "gt-keyring-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			var req struct{ Service, Account string }
+			line, _ := bufio.NewReader(conn).ReadBytes('\n')
+			resp := map[string]string{"error": "invalid request"}
+			if json.Unmarshal(line, &req) == nil {
+				if secret, ok := secrets[req.Service+"/"+req.Account]; ok {
+					resp = map[string]string{"secret": secret}
+				} else {
+					resp = map[string]string{"error": "no such account"}
+				}
+			}
+			b, _ := json.Marshal(resp)
+			conn.Write(append(b, '\n'))
+			conn.Close()
+		}
+	}()
+	return socket
+}
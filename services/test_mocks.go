@@ -1,20 +1,107 @@
 package services
 
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/guardtime/goksi/hash"
+	"github.com/guardtime/goksi/service"
+	"github.com/guardtime/goksi/signature"
+)
+
 type ArchiveServiceMock struct {
-	CreateArchiveFunc func(filePaths []string, destinationPath string) error
-	ExtractFunc       func(archivePath string) ([]string, error)
+	CreateArchiveFunc func(entries []ArchiveEntry, w io.Writer) error
+	ReadArchiveFunc   func(r io.ReaderAt, size int64) ([]ArchiveEntry, error)
+	AppendArchiveFunc func(r io.ReaderAt, size int64, entries []ArchiveEntry, w io.Writer) error
+	ExtractFunc       func(archivePath, outDir string) ([]string, error)
+
+	ReadArchiveWithDuplicatesFunc func(r io.ReaderAt, size int64) ([]ArchiveEntry, error)
+	ReplaceArchiveFunc            func(r io.ReaderAt, size int64, entries []ArchiveEntry, w io.Writer) error
 }
 
-func (m ArchiveServiceMock) CreateArchive(filePaths []string, destinationPath string) error {
+func (m ArchiveServiceMock) CreateArchive(entries []ArchiveEntry, w io.Writer) error {
 	if m.CreateArchiveFunc == nil {
 		panic("CreateArchiveFunc is uninitialized!")
 	}
-	return m.CreateArchiveFunc(filePaths, destinationPath)
+	return m.CreateArchiveFunc(entries, w)
+}
+
+func (m ArchiveServiceMock) ReadArchive(r io.ReaderAt, size int64) ([]ArchiveEntry, error) {
+	if m.ReadArchiveFunc == nil {
+		panic("ReadArchiveFunc is uninitialized!")
+	}
+	return m.ReadArchiveFunc(r, size)
+}
+
+func (m ArchiveServiceMock) ReadArchiveWithDuplicates(r io.ReaderAt, size int64) ([]ArchiveEntry, error) {
+	if m.ReadArchiveWithDuplicatesFunc == nil {
+		panic("ReadArchiveWithDuplicatesFunc is uninitialized!")
+	}
+	return m.ReadArchiveWithDuplicatesFunc(r, size)
 }
 
-func (m ArchiveServiceMock) Extract(archivePath string) ([]string, error) {
+func (m ArchiveServiceMock) AppendArchive(r io.ReaderAt, size int64, entries []ArchiveEntry, w io.Writer) error {
+	if m.AppendArchiveFunc == nil {
+		panic("AppendArchiveFunc is uninitialized!")
+	}
+	return m.AppendArchiveFunc(r, size, entries, w)
+}
+
+func (m ArchiveServiceMock) ReplaceArchive(r io.ReaderAt, size int64, entries []ArchiveEntry, w io.Writer) error {
+	if m.ReplaceArchiveFunc == nil {
+		panic("ReplaceArchiveFunc is uninitialized!")
+	}
+	return m.ReplaceArchiveFunc(r, size, entries, w)
+}
+
+func (m ArchiveServiceMock) Extract(archivePath, outDir string) ([]string, error) {
 	if m.ExtractFunc == nil {
 		panic("ExtractFunc is uninitialized!")
 	}
-	return m.ExtractFunc(archivePath)
+	return m.ExtractFunc(archivePath, outDir)
+}
+
+type KSISignerMock struct {
+	SignFunc func(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error)
+}
+
+func (m KSISignerMock) Sign(ctx context.Context, hash hash.Imprint, opt ...service.SignOption) (*signature.Signature, error) {
+	if m.SignFunc == nil {
+		panic("SignFunc is uninitialized!")
+	}
+	return m.SignFunc(ctx, hash, opt...)
+}
+
+type KSIVerifierMock struct {
+	VerifyFunc func(sig []byte, document []byte, policy VerificationPolicy) (KSIVerificationResult, error)
+}
+
+func (m KSIVerifierMock) Verify(sig []byte, document []byte, policy VerificationPolicy) (KSIVerificationResult, error) {
+	if m.VerifyFunc == nil {
+		panic("VerifyFunc is uninitialized!")
+	}
+	return m.VerifyFunc(sig, document, policy)
+}
+
+type KSIExtenderMock struct {
+	ExtendFunc func(ctx context.Context, sig []byte, pubTime time.Time) ([]byte, error)
+}
+
+func (m KSIExtenderMock) Extend(ctx context.Context, sig []byte, pubTime time.Time) ([]byte, error) {
+	if m.ExtendFunc == nil {
+		panic("ExtendFunc is uninitialized!")
+	}
+	return m.ExtendFunc(ctx, sig, pubTime)
+}
+
+type KSIInspectorMock struct {
+	InspectFunc func(sig []byte) (KSISignatureInfo, error)
+}
+
+func (m KSIInspectorMock) Inspect(sig []byte) (KSISignatureInfo, error) {
+	if m.InspectFunc == nil {
+		panic("InspectFunc is uninitialized!")
+	}
+	return m.InspectFunc(sig)
 }